@@ -3,10 +3,14 @@ package main
 // run: make run
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"runtime"
+	"syscall"
 
 	"github.com/snipem/monako/pkg/compose"
 	"github.com/snipem/monako/pkg/helpers"
@@ -19,6 +23,7 @@ func parseCommandLine() (cliSettings compose.CommandLineSettings) {
 	f := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
 
 	var configfilepath = f.String("config", "config.monako.yaml", "Configuration file")
+	var configFormat = f.String("config-format", "", "Format of the configuration file (yaml, toml or json), detected by extension if not set")
 	var menuconfigfilepath = f.String("menu-config", "config.menu.md", "Menu file for monako-book theme")
 	var workingdir = f.String("working-dir", ".", "Working dir for composed site")
 	var baseURL = f.String("base-url", "", "Custom base URL")
@@ -27,6 +32,8 @@ func parseCommandLine() (cliSettings compose.CommandLineSettings) {
 	var failOnHugoError = f.Bool("fail-on-error", false, "Fail on document conversion errors")
 	var onlyCompose = f.Bool("compose", false, "Only compose the Monako structure")
 	var onlyRender = f.Bool("render", false, "Only render HTML files from an existing Monako structure")
+	var incremental = f.Bool("incremental", false, "Keep the Monako structure of the last build and only rewrite changed files")
+	var dryRun = f.Bool("dry-run", false, "Print the files that would be composed without writing anything")
 
 	err := f.Parse(os.Args[1:])
 	if err != nil {
@@ -35,9 +42,13 @@ func parseCommandLine() (cliSettings compose.CommandLineSettings) {
 	if *onlyCompose && *onlyRender {
 		log.Fatal("compose and render can't be set both")
 	}
+	if *dryRun && *onlyRender {
+		log.Fatal("dry-run and render can't be set both")
+	}
 
 	return compose.CommandLineSettings{
 		ConfigFilePath:     *configfilepath,
+		ConfigFormat:       *configFormat,
 		MenuConfigFilePath: *menuconfigfilepath,
 		ContentWorkingDir:  *workingdir,
 		BaseURL:            *baseURL,
@@ -46,6 +57,8 @@ func parseCommandLine() (cliSettings compose.CommandLineSettings) {
 		FailOnHugoError:    *failOnHugoError,
 		OnlyCompose:        *onlyCompose,
 		OnlyRender:         *onlyRender,
+		Incremental:        *incremental,
+		DryRun:             *dryRun,
 	}
 }
 
@@ -57,8 +70,45 @@ var commit = "Local"
 
 //go:generate go-bindata -pkg theme -o ../../pkg/compose/internal/bindata.go -ignore "\\.git" -ignore "exampleSite" -prefix "../../assets/theme/" ../../assets/theme/monako-book/...
 
+// validate checks the Monako config given by the command line arguments and prints
+// all problems found. Returns the exit code of the validate command
+func validate(args []string, out io.Writer) int {
+
+	f := flag.NewFlagSet("validate", flag.ContinueOnError)
+	f.SetOutput(out)
+	var configfilepath = f.String("config", "config.monako.yaml", "Configuration file")
+	var configFormat = f.String("config-format", "", "Format of the configuration file (yaml, toml or json), detected by extension if not set")
+
+	err := f.Parse(args)
+	if err != nil {
+		return 2
+	}
+
+	config, err := compose.LoadConfigWithFormat(*configfilepath, *configFormat, "")
+	if errs, isConfigErrors := err.(compose.ConfigErrors); isConfigErrors {
+		for _, e := range errs {
+			fmt.Fprintln(out, e.Error())
+		}
+		fmt.Fprintf(out, "Found %d problem(s) in %s\n", len(errs), *configfilepath)
+		return 1
+	} else if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+
+	for _, warning := range config.Warnings() {
+		fmt.Fprintf(out, "warning: %s\n", warning.Error())
+	}
+	fmt.Fprintf(out, "%s is valid\n", *configfilepath)
+	return 0
+}
+
 func main() {
 
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(validate(os.Args[2:], os.Stdout))
+	}
+
 	cliSettings := parseCommandLine()
 
 	// Always print version
@@ -72,21 +122,29 @@ func main() {
 		helpers.Trace()
 	}
 
-	config := compose.Init(cliSettings)
-	if !cliSettings.OnlyRender {
-		err := config.Compose()
-		if err != nil {
-			log.Fatal(err)
-		}
+	// Stop building on Ctrl-C. A second Ctrl-C kills Monako immediately
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := run(ctx, cliSettings)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	if !cliSettings.OnlyCompose {
-		err := config.Generate()
-		if cliSettings.FailOnHugoError && err != nil {
-			log.Fatal(err)
-		}
+}
+
+// run builds the Monako site with the given settings
+func run(ctx context.Context, cliSettings compose.CommandLineSettings) error {
+
+	config, err := compose.New(cliSettings)
+	if err != nil {
+		return err
 	}
 
+	return config.Build(ctx)
 }
 
 func getVersion() string {
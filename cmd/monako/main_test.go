@@ -3,6 +3,8 @@ package main
 // run: go test -v ./cmd/monako
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -18,6 +20,7 @@ import (
 	"github.com/PuerkitoBio/goquery"
 	"github.com/mmcdole/gofeed"
 	log "github.com/sirupsen/logrus"
+	"github.com/snipem/monako/pkg/compose"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/net/html"
 )
@@ -226,24 +229,82 @@ func TestMainSplitCalls(t *testing.T) {
 
 func TestFailOnNoComposeBeforeGenerate(t *testing.T) {
 
-	t.Skip("Does not work since fatal can not be intercepted")
 	targetDir := GetLocalTempDir(t)
 	err := os.Chdir(targetDir)
 	assert.NoError(t, err)
 
 	monakoConfig, menuConfig := writeConfig("https://github.com/snipem/monako-test.git")
-	os.Args = []string{
-		"monako",
-		"-render",
-		"-fail-on-error",
-		"-working-dir", targetDir,
-		"-config", monakoConfig,
-		"-menu-config", menuConfig}
-	t.Logf("Running Monako with %s", os.Args)
-	main()
+	err = run(context.Background(), compose.CommandLineSettings{
+		ConfigFilePath:     monakoConfig,
+		MenuConfigFilePath: menuConfig,
+		ContentWorkingDir:  targetDir,
+		OnlyRender:         true,
+		FailOnHugoError:    true,
+	})
+	assert.Error(t, err)
 	assert.NoDirExists(t, filepath.Join(targetDir, "compose", "public"))
 }
 
+func TestValidate(t *testing.T) {
+
+	targetDir := GetLocalTempDir(t)
+
+	t.Run("Valid config", func(t *testing.T) {
+		validConfig := filepath.Join(targetDir, "config.valid.yaml")
+		err := ioutil.WriteFile(validConfig, []byte(`
+origins:
+  - src: https://github.com/snipem/monako-test.git
+    branch: master
+    targetdir: docs/test
+`), os.FileMode(0600))
+		assert.NoError(t, err)
+
+		out := &bytes.Buffer{}
+		assert.Equal(t, 0, validate([]string{"-config", validConfig}, out))
+		assert.Contains(t, out.String(), "is valid")
+	})
+
+	t.Run("Warnings", func(t *testing.T) {
+		nestedConfig := filepath.Join(targetDir, "config.nested.yaml")
+		err := ioutil.WriteFile(nestedConfig, []byte(`
+origins:
+  - src: https://github.com/snipem/monako-test.git
+    branch: master
+    targetdir: docs
+  - src: https://github.com/snipem/monako.git
+    branch: master
+    targetdir: docs/monako
+`), os.FileMode(0600))
+		assert.NoError(t, err)
+
+		out := &bytes.Buffer{}
+		assert.Equal(t, 0, validate([]string{"-config", nestedConfig}, out))
+		assert.Contains(t, out.String(), "warning: "+nestedConfig+":8: origins[1].targetdir: is nested with targetdir \"docs\" of origins[0]")
+		assert.Contains(t, out.String(), "is valid")
+	})
+
+	t.Run("Invalid config", func(t *testing.T) {
+		invalidConfig := filepath.Join(targetDir, "config.invalid.yaml")
+		err := ioutil.WriteFile(invalidConfig, []byte(`
+origins:
+  - src: https://github.com/snipem/monako-test.git
+    targetDir: docs/test
+`), os.FileMode(0600))
+		assert.NoError(t, err)
+
+		out := &bytes.Buffer{}
+		assert.Equal(t, 1, validate([]string{"-config", invalidConfig}, out))
+		assert.Contains(t, out.String(), "config.invalid.yaml:3: origins[0].branch: field is required")
+		assert.Contains(t, out.String(), "config.invalid.yaml:4: origins[0].targetDir: unknown field")
+		assert.Contains(t, out.String(), "Found 2 problem(s)")
+	})
+
+	t.Run("Missing config", func(t *testing.T) {
+		out := &bytes.Buffer{}
+		assert.Equal(t, 1, validate([]string{"-config", filepath.Join(targetDir, "missing.yaml")}, out))
+	})
+}
+
 func getContentFromURL(ts *httptest.Server, url string) (string, error) {
 	// res, err := http.Get(ts.URL)
 	res, err := http.Get(ts.URL + url)
@@ -0,0 +1,75 @@
+package compose
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Policies for files of different origins composed to the same target path
+const (
+	// CollisionError fails composing
+	CollisionError = "error"
+	// CollisionWarn logs a warning, the file of the later origin overwrites the earlier one
+	CollisionWarn = "warn"
+	// CollisionSuffix composes the file of the later origin with a numbered suffix, like README-2.md
+	CollisionSuffix = "suffix"
+)
+
+// collisionPolicies are all supported collision policies
+var collisionPolicies = []string{CollisionError, CollisionWarn, CollisionSuffix}
+
+// isCollisionPolicy returns true if the policy is supported
+func isCollisionPolicy(policy string) bool {
+	for _, supported := range collisionPolicies {
+		if policy == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// source describes the origin and remote path of the file
+func (file *OriginFile) source() string {
+	return fmt.Sprintf("%s %s", file.parentOrigin.URL, file.RemotePath)
+}
+
+// claimLocalPath registers the target path of the file before it is composed. If another
+// file has already been composed to it, the collision policy of the config is applied
+func (config *Config) claimLocalPath(file *OriginFile) error {
+	if config.targets == nil {
+		config.targets = map[string]string{}
+	}
+
+	earlier, collides := config.targets[file.LocalPath]
+	if !collides || earlier == file.source() {
+		config.targets[file.LocalPath] = file.source()
+		return nil
+	}
+
+	switch config.Collisions {
+	case CollisionWarn:
+		log.Warnf("%s overwrites %s at %s", file.source(), earlier, file.LocalPath)
+	case CollisionSuffix:
+		localPath := file.LocalPath
+		for i := 2; collides; i++ {
+			localPath = suffixedPath(file.LocalPath, i)
+			_, collides = config.targets[localPath]
+		}
+		log.Warnf("%s collides with %s at %s, composing to %s", file.source(), earlier, file.LocalPath, localPath)
+		file.LocalPath = localPath
+	default:
+		return fmt.Errorf("%s and %s are both composed to %s, set collisions to warn or suffix to resolve", earlier, file.source(), file.LocalPath)
+	}
+
+	config.targets[file.LocalPath] = file.source()
+	return nil
+}
+
+// suffixedPath returns the path with the number added before the extension
+func suffixedPath(localPath string, number int) string {
+	extension := filepath.Ext(localPath)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(localPath, extension), number, extension)
+}
@@ -0,0 +1,85 @@
+package compose
+
+// run: go test ./pkg/compose -run TestCollisions
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollisions(t *testing.T) {
+
+	composeCollidingOrigins := func(t *testing.T, policy string) (*Config, string, string, error) {
+		first := writeTestFiles(t, map[string]string{"README.md": "# First"})
+		second := writeTestFiles(t, map[string]string{"README.md": "# Second", "guide.md": "# Guide"})
+		config, _ := getTestConfig(t,
+			Origin{Type: LocalSource, URL: first, TargetDir: "docs"},
+			Origin{Type: LocalSource, URL: second, TargetDir: "docs"},
+		)
+		config.Collisions = policy
+		return config, first, second, config.Compose(context.Background())
+	}
+
+	readme := func(t *testing.T, config *Config, name string) string {
+		content, err := ioutil.ReadFile(filepath.Join(config.ContentWorkingDir, "docs", name))
+		assert.NoError(t, err)
+		return string(content)
+	}
+
+	for _, policy := range []string{"", CollisionError} {
+		t.Run("Error policy "+policy, func(t *testing.T) {
+			_, first, second, err := composeCollidingOrigins(t, policy)
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), first+" README.md and "+second+" README.md are both composed to ")
+		})
+	}
+
+	t.Run("Warn policy", func(t *testing.T) {
+		config, _, _, err := composeCollidingOrigins(t, CollisionWarn)
+		assert.NoError(t, err)
+		assert.Contains(t, readme(t, config, "README.md"), "# Second", "Later origin wins")
+	})
+
+	t.Run("Suffix policy", func(t *testing.T) {
+		config, _, _, err := composeCollidingOrigins(t, CollisionSuffix)
+		assert.NoError(t, err)
+		assert.Contains(t, readme(t, config, "README.md"), "# First")
+		assert.Contains(t, readme(t, config, "README-2.md"), "# Second")
+		assert.Contains(t, readme(t, config, "guide.md"), "# Guide")
+
+		file := config.Origins[1].Files[0]
+		assert.Equal(t, "docs/README-2.md", file.contentPath())
+	})
+
+	t.Run("Same origin composed again", func(t *testing.T) {
+		config, _ := getTestConfig(t, Origin{Type: LocalSource, URL: writeTestFiles(t, map[string]string{"README.md": "# Readme"}), TargetDir: "docs"})
+		assert.NoError(t, config.Compose(context.Background()))
+		assert.NoError(t, config.Compose(context.Background()))
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		origins := `
+origins:
+  - src: https://github.com/snipem/monako-test.git
+    branch: master
+    targetdir: docs
+  - src: https://github.com/snipem/monako-test.git
+    branch: develop
+    targetdir: docs
+`
+		_, err := LoadConfig(writeTestConfig(t, "collisions: suffix"+origins), "")
+		assert.NoError(t, err, "Overlapping targetdirs are allowed with a policy")
+
+		_, err = LoadConfig(writeTestConfig(t, "collisions: ignore"+origins), "")
+		assert.Error(t, err)
+		errs := err.(ConfigErrors)
+		assert.Len(t, errs, 1)
+		assert.Equal(t, "collisions", errs[0].Field)
+		assert.Equal(t, 1, errs[0].Line)
+		assert.Equal(t, "unknown policy, use one of error, warn, suffix", errs[0].Message)
+	})
+}
@@ -0,0 +1,143 @@
+package compose
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// CommandProcessor pipes documents through an external command
+const CommandProcessor = "command"
+
+// defaultCommandTimeout limits the runtime of a command for a single document
+const defaultCommandTimeout = time.Minute
+
+// commandWaitDelay is the time to wait for the output of a command after it has been killed
+const commandWaitDelay = time.Second
+
+// commandProcessor runs Command with the document as stdin and uses stdout as new content.
+// The command has to be listed in the allowedCommands of the config
+type commandProcessor struct {
+	Command []string          `yaml:"command"`
+	Env     map[string]string `yaml:"env"`
+	Timeout time.Duration     `yaml:"timeout"`
+}
+
+func newCommandProcessor(options ProcessorOptions) (Processor, error) {
+	processor := &commandProcessor{}
+	if err := options.Decode(processor); err != nil {
+		return nil, err
+	}
+	if len(processor.Command) == 0 || processor.Command[0] == "" {
+		return nil, fmt.Errorf("option command is required")
+	}
+	if processor.Timeout < 0 {
+		return nil, fmt.Errorf("option timeout must not be negative")
+	}
+	if processor.Timeout == 0 {
+		processor.Timeout = defaultCommandTimeout
+	}
+	return processor, nil
+}
+
+// Process runs the command for the file. Output on stderr is returned as error if the command fails
+// and logged as warning otherwise
+func (processor *commandProcessor) Process(ctx context.Context, file *OriginFile, content []byte) ([]byte, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, processor.Timeout)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	env := append(commandEnv(file), sortedEnv(processor.Env)...)
+
+	log.Debugf("Running %s for %s", strings.Join(processor.Command, " "), file.RemotePath)
+	message, err := runCommand(ctx, processor.Command, env, bytes.NewReader(content), &stdout)
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("command %s for %s timed out after %s", processor.Command[0], file.RemotePath, processor.Timeout)
+	}
+	if err != nil {
+		if message != "" {
+			return nil, fmt.Errorf("command %s failed for %s: %s: %s", processor.Command[0], file.RemotePath, err, message)
+		}
+		return nil, fmt.Errorf("command %s failed for %s: %s", processor.Command[0], file.RemotePath, err)
+	}
+	if message != "" {
+		log.Warnf("Command %s for %s: %s", processor.Command[0], file.RemotePath, message)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// runCommand runs the command with the environment of Monako extended by env. The output on
+// stdout is written to stdout, the output on stderr is returned
+func runCommand(ctx context.Context, command []string, env []string, stdin io.Reader, stdout io.Writer) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+	cmd.Env = append(os.Environ(), env...)
+	// Don't wait for children of a killed command still holding stdout or stderr
+	cmd.WaitDelay = commandWaitDelay
+
+	err := cmd.Run()
+	return strings.TrimSpace(stderr.String()), err
+}
+
+// sortedEnv returns the variables as environment variables sorted by name
+func sortedEnv(variables map[string]string) []string {
+	var env []string
+	for key, value := range variables {
+		env = append(env, fmt.Sprintf("%s=%s", key, value))
+	}
+	sort.Strings(env)
+	return env
+}
+
+// commandEnv returns the environment variables describing the file for a command
+func commandEnv(file *OriginFile) []string {
+	env := []string{
+		"MONAKO_REMOTE_PATH=" + file.RemotePath,
+		"MONAKO_LOCAL_PATH=" + file.LocalPath,
+		"MONAKO_FORMAT=" + file.GetFormat(),
+	}
+	if origin := file.parentOrigin; origin != nil {
+		env = append(env,
+			"MONAKO_ORIGIN_SRC="+origin.URL,
+			"MONAKO_ORIGIN_BRANCH="+origin.Branch,
+			"MONAKO_ORIGIN_DOCDIR="+origin.SourceDir,
+			"MONAKO_ORIGIN_TARGETDIR="+origin.TargetDir,
+		)
+	}
+	return env
+}
+
+// checkCommandAllowed returns an error if the processor is a command processor running
+// a command that is not in the allowed commands
+func checkCommandAllowed(processorConfig ProcessorConfig, allowedCommands []string) error {
+	if processorConfig.Name != CommandProcessor {
+		return nil
+	}
+
+	processor := &commandProcessor{}
+	if err := processorConfig.Options.Decode(processor); err != nil || len(processor.Command) == 0 {
+		// Reported when creating the processor
+		return nil
+	}
+
+	for _, allowed := range allowedCommands {
+		if allowed == processor.Command[0] {
+			return nil
+		}
+	}
+	return fmt.Errorf("command %q is not allowed, add it to allowedCommands", processor.Command[0])
+}
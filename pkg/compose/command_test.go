@@ -0,0 +1,111 @@
+package compose
+
+// run: go test ./pkg/compose -run TestCommand
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandProcessor(t *testing.T) {
+	filesystem := newTestFilesystem(t, map[string]string{"docs/README.md": "# Hello"})
+
+	t.Run("Content and metadata", func(t *testing.T) {
+		assert.Equal(t, "# HELLO\ndocs/README.md MARKDOWN master custom\n", runProcessor(t, ProcessorConfig{
+			Name: CommandProcessor,
+			Options: ProcessorOptions{
+				"command": []string{"sh", "-c", `tr a-z A-Z; echo; echo "$MONAKO_REMOTE_PATH $MONAKO_FORMAT $MONAKO_ORIGIN_BRANCH $CUSTOM"`},
+				"env":     map[string]string{"CUSTOM": "custom"},
+			},
+		}, filesystem, "docs/README.md"))
+	})
+
+	for name, test := range map[string]struct {
+		options  ProcessorOptions
+		expected string
+	}{
+		"Failing command": {
+			ProcessorOptions{"command": []string{"sh", "-c", "echo broken input >&2; exit 3"}},
+			"command sh failed for docs/README.md: exit status 3: broken input",
+		},
+		"Timeout": {
+			ProcessorOptions{"command": []string{"sh", "-c", "sleep 5"}, "timeout": "50ms"},
+			"command sh for docs/README.md timed out after 50ms",
+		},
+		"Missing command": {
+			ProcessorOptions{"command": []string{"monako-not-existing-command"}},
+			"command monako-not-existing-command failed for docs/README.md",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			processor, err := newProcessor(ProcessorConfig{Name: CommandProcessor, Options: test.options})
+			assert.NoError(t, err)
+
+			file := &OriginFile{RemotePath: "docs/README.md", filesystem: filesystem}
+			_, err = processor.Process(context.Background(), file, []byte("# Hello"))
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), test.expected)
+		})
+	}
+
+	t.Run("Invalid options", func(t *testing.T) {
+		_, err := newProcessor(ProcessorConfig{Name: CommandProcessor})
+		assert.Error(t, err)
+		_, err = newProcessor(ProcessorConfig{Name: CommandProcessor, Options: ProcessorOptions{"command": []string{"cat"}, "timeout": "-1s"}})
+		assert.Error(t, err)
+	})
+}
+
+func TestCommandAllowlist(t *testing.T) {
+
+	t.Run("Allowed command is run when composing", func(t *testing.T) {
+		config, _ := getTestConfig(t, Origin{
+			URL:           "https://github.com/snipem/monako-test.git",
+			SourceDir:     "docs",
+			TargetDir:     "docs/test",
+			FileWhitelist: []string{".md"},
+			Processors:    []ProcessorConfig{{Name: CommandProcessor, Options: ProcessorOptions{"command": []string{"rev"}}}},
+		})
+		config.AllowedCommands = []string{"rev"}
+
+		err := config.Origins[0].ComposeDir(context.Background(), newTestFilesystem(t, map[string]string{"docs/README.md": "# Hello\n"}))
+		assert.NoError(t, err)
+
+		content, err := ioutil.ReadFile(filepath.Join(config.ContentWorkingDir, "docs/test/README.md"))
+		assert.NoError(t, err)
+		assert.Equal(t, "olleH #\n", string(content))
+
+		config.AllowedCommands = nil
+		err = config.Origins[0].ComposeDir(context.Background(), newTestFilesystem(t, map[string]string{"docs/README.md": "# Hello\n"}))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), `command "rev" is not allowed`)
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		configFile := writeTestConfig(t, `
+allowedCommands: [pandoc]
+origins:
+  - src: https://github.com/snipem/monako-test.git
+    branch: master
+    targetdir: docs/test
+    processors:
+      - name: command
+        options:
+          command: [pandoc, -t, gfm]
+      - name: command
+        options:
+          command: [./scripts/filter.sh]
+`)
+		_, err := LoadConfig(configFile, "")
+		assert.Error(t, err)
+		errs := err.(ConfigErrors)
+		assert.Len(t, errs, 1)
+		assert.Equal(t, "origins[0].processors[1].options.command", errs[0].Field)
+		assert.Equal(t, 13, errs[0].Line)
+		assert.Contains(t, errs[0].Message, `command "./scripts/filter.sh" is not allowed`)
+	})
+}
@@ -1,17 +1,25 @@
 package compose
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/snipem/monako/pkg/helpers"
-	"gopkg.in/yaml.v2"
 )
 
+// publicDirectory is the folder within the compose folder where Hugo renders to
+const publicDirectory = "public"
+
+// renderDirectoryPattern names the temporary folders Hugo renders to before replacing the public folder.
+// Every run uses its own folder, so a cancelled run finishing late can't remove the folder of another run
+const renderDirectoryPattern = ".public.tmp-*"
+
 // Config is the root of the Monako config
 type Config struct {
 	BaseURL       string   `yaml:"baseURL"`
@@ -23,17 +31,68 @@ type Config struct {
 
 	DisableCommitInfo bool `yaml:"disableCommitInfo"`
 
+	// History is the number of commits listed in the history of every document.
+	// The history and the contributors are not added if 0
+	History int `yaml:"history,omitempty"`
+
+	// Staleness marks documents as stale and reports them
+	Staleness StalenessConfig `yaml:"staleness,omitempty"`
+
+	// RepoSettings restricts the settings origins read from .monakoignore, .gitattributes and .monako.yaml in their docdir
+	RepoSettings RepoSettingsPolicy `yaml:"repoSettings,omitempty"`
+
+	// GitProviders maps hosts to the provider used for links to the web interface, for example
+	// "git.example.com: gitlab". Public services and hosts containing the provider name are detected
+	GitProviders map[string]string `yaml:"gitProviders,omitempty"`
+
+	// Frontmatter configures how Monako fields are merged into the front matter of documents
+	Frontmatter FrontmatterConfig `yaml:"frontmatter,omitempty"`
+
+	// Processors are used for all origins without own processors
+	Processors []ProcessorConfig `yaml:"processors,omitempty"`
+	// AllowedCommands are the commands command processors are allowed to run
+	AllowedCommands []string `yaml:"allowedCommands,omitempty"`
+
+	// Hooks are commands run at the lifecycle points of the build
+	Hooks Hooks `yaml:"hooks,omitempty"`
+
+	// Timeout limits the duration of the whole build, for example "10m". No limit if empty
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+
+	// Collisions is the policy for files of different origins composed to the same path:
+	// error, warn or suffix. If empty, overlapping targetdirs are not allowed and collisions are errors
+	Collisions string `yaml:"collisions,omitempty"`
+
+	// Extends is the path to a config file this config is based on
+	Extends string `yaml:"extends,omitempty"`
+	// Include contains paths to config files that are merged into this config
+	Include []string `yaml:"include,omitempty"`
+
 	// HugoWorkingDir is the working dir for the Composition. For example "your/dir/compose"
-	HugoWorkingDir string
+	HugoWorkingDir string `yaml:"-"`
 
 	// ContentWorkingDir is the main working dir and where all the content is stored in. For example "your/dir/"
-	ContentWorkingDir string
+	ContentWorkingDir string `yaml:"-"`
+
+	// source is the parsed config file, used for reporting problems with line numbers
+	source *configSource
+
+	// settings are the command line settings given to New
+	settings CommandLineSettings
+
+	// hookFuncs are the Go functions added by AddHook
+	hookFuncs map[string][]HookFunc
+
+	// targets maps the local paths of the composed files to their source
+	targets map[string]string
 }
 
 // CommandLineSettings contains all the flags and settings made via the command line in main
 type CommandLineSettings struct {
 	// ConfigFilePath is the path to the Monako config
 	ConfigFilePath string
+	// ConfigFormat is the format of the Monako config, detected by the file extension if empty
+	ConfigFormat string
 	// MenuConfigFilePath is the path to the Menu config
 	MenuConfigFilePath string
 	// ContentWorkingDir is the directory where files should be created. Home of the compose folder.
@@ -50,21 +109,41 @@ type CommandLineSettings struct {
 	OnlyCompose bool
 	// OnlyRender will only render HTML files but not compose them
 	OnlyRender bool
+	// Incremental keeps the compose folder of the last build and only rewrites changed files
+	Incremental bool
+	// DryRun prints the plan of the files that would be composed without writing anything
+	DryRun bool
 }
 
-// LoadConfig returns the Monako config from the given configfilepath
+// LoadConfig returns the Monako config from the given configfilepath.
+// The format (YAML, TOML or JSON) is detected by the file extension.
+// Environment variables are interpolated and included config files are merged.
+// If the config contains unknown fields or fails validation, all problems
+// are returned as ConfigErrors
 func LoadConfig(configfilepath string, workingdir string) (config *Config, err error) {
+	return LoadConfigWithFormat(configfilepath, "", workingdir)
+}
 
-	source, err := ioutil.ReadFile(configfilepath)
-	if err != nil {
-		return
-	}
+// LoadConfigWithFormat is like LoadConfig but uses the given format for the config file
+// if it is not empty. Included config files are always detected by their extension
+func LoadConfigWithFormat(configfilepath string, format string, workingdir string) (config *Config, err error) {
 
-	err = yaml.Unmarshal(source, &config)
+	source, errs, err := loadConfigSource(configfilepath, format)
 	if err != nil {
 		return nil, err
 	}
 
+	config = &Config{source: source}
+	err = source.root.Decode(config)
+	if err != nil && len(errs) == 0 {
+		errs = append(errs, newConfigError(configfilepath, err))
+	}
+
+	errs = append(errs, config.Validate()...)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
 	config.initConfig(workingdir)
 
 	return config, nil
@@ -87,32 +166,49 @@ func (config *Config) initConfig(workingdir string) {
 
 }
 
-// Compose builds the Monako directory structure
-func (config *Config) Compose() error {
+// Compose builds the Monako directory structure and runs the pre and post compose hooks.
+// Composing stops if the context is done or the timeout of an origin is exceeded, the
+// incomplete output is rolled back then.
+// In incremental mode unchanged files are not rewritten and files composed by the last
+// build that are no longer part of an origin are removed
+func (config *Config) Compose(ctx context.Context) error {
 
-	// If Origin has now own whitelist, use the Compose Whitelist
-	for i := range config.Origins {
-		if config.Origins[i].FileWhitelist == nil {
-			config.Origins[i].FileWhitelist = config.FileWhitelist
-		}
-		if config.Origins[i].FileBlacklist == nil {
-			config.Origins[i].FileBlacklist = config.FileBlacklist
-		}
+	err := config.createWorkingDir()
+	if err != nil {
+		return err
+	}
 
-		filesystem, err := config.Origins[i].CloneDir()
-		if err != nil {
-			return errors.Wrap(err, fmt.Sprintf("Error cloning origin %s", config.Origins[i].URL))
+	previousState := config.readComposeState()
+	config.targets = nil
+	composed := false
+	defer func() {
+		if !composed {
+			config.rollBack(previousState)
 		}
+	}()
 
-		err = config.Origins[i].ComposeDir(filesystem)
+	err = config.runHooks(ctx, PreCompose)
+	if err != nil {
+		return err
+	}
+
+	err = config.DiscoverOrigins(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := range config.Origins {
+		config.applyDefaults(&config.Origins[i])
+
+		err := config.Origins[i].compose(ctx)
 		if err != nil {
-			return errors.Wrap(err, fmt.Sprintf("Error composing dir '%s' of %s", config.Origins[i].SourceDir, config.Origins[i].URL))
+			return err
 		}
 
 		// After processing the origin, delete repo for freeing up memory
 		// containing the whole virtual filesystem. Can easily add up to
 		// multiple gigabyte
-		config.Origins[i].repo = nil
+		config.Origins[i].commits = nil
 
 		// Performance analysis ------
 
@@ -132,22 +228,86 @@ func (config *Config) Compose() error {
 		// End Performance analysis ------
 
 	}
-	return nil
 
+	state := config.newComposeState()
+	if config.incremental() {
+		err = config.removeStaleFiles(previousState, state)
+		if err != nil {
+			return err
+		}
+	}
+	err = config.writeComposeState(state)
+	if err != nil {
+		return err
+	}
+	composed = true
+
+	err = config.writeManifest(config.newManifest())
+	if err != nil {
+		return err
+	}
+
+	err = config.checkStaleness(os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	return config.runHooks(ctx, PostCompose)
+
+}
+
+// applyDefaults sets the whitelist, blacklist and processors of the config for an origin
+// without own ones
+func (config *Config) applyDefaults(origin *Origin) {
+	if origin.FileWhitelist == nil {
+		origin.FileWhitelist = config.FileWhitelist
+	}
+	if origin.FileBlacklist == nil {
+		origin.FileBlacklist = config.FileBlacklist
+	}
+	if origin.Processors == nil {
+		origin.Processors = config.Processors
+	}
 }
 
-// CleanUp removes the compose folder
-func (config *Config) CleanUp() {
+// compose fetches and composes the origin within its timeout
+func (origin *Origin) compose(ctx context.Context) error {
+
+	if origin.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, origin.Timeout)
+		defer cancel()
+	}
+
+	filesystem, err := origin.Fetch(ctx)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Error fetching origin %s", origin.URL))
+	}
+
+	err = origin.ComposeDir(ctx, filesystem)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Error composing dir '%s' of %s", origin.SourceDir, origin.URL))
+	}
+	return nil
+}
+
+// CleanUp removes the compose folder. Folders that have not been created by Monako
+// are only removed if they are empty
+func (config *Config) CleanUp() error {
 
 	if (config.HugoWorkingDir) == "." {
-		log.Fatalf("Hugo working dir can't be .")
+		return fmt.Errorf("Hugo working dir can't be .")
+	}
+	if entries, err := ioutil.ReadDir(config.HugoWorkingDir); err == nil && len(entries) > 0 && !isMonakoDir(config.HugoWorkingDir) {
+		return fmt.Errorf("Refusing to clean up %s, it was not created by Monako", config.HugoWorkingDir)
 	}
 	err := os.RemoveAll(config.HugoWorkingDir)
 	if err != nil {
-		log.Fatalf("CleanUp: Error while cleaning up: %s", err)
+		return errors.Wrap(err, "Error while cleaning up")
 	}
 
 	log.Infof("Cleaned up: %s", config.HugoWorkingDir)
+	return nil
 }
 
 // setWorkingDir sets the target dir. Standard is relative to the current directory (".")
@@ -157,47 +317,171 @@ func (config *Config) setWorkingDir(workingdir string) {
 	}
 }
 
-// Init loads the Monako config, adds Workarounds, runs Hugo for initializing the working directory
-func Init(cliSettings CommandLineSettings) (config *Config) {
-
-	config, err := LoadConfig(cliSettings.ConfigFilePath, cliSettings.ContentWorkingDir)
+// Init loads the Monako config and prepares the working directory, exiting the process on errors
+//
+// Deprecated: Use New
+func Init(cliSettings CommandLineSettings) *Config {
+	config, err := New(cliSettings)
 	if err != nil {
 		log.Fatal(err)
 	}
+	return config
+}
+
+// New loads the Monako config, applies the command line settings and prepares the working
+// directory for composing. It never exits the process, all problems are returned as errors
+func New(cliSettings CommandLineSettings) (*Config, error) {
+
+	config, err := LoadConfigWithFormat(cliSettings.ConfigFilePath, cliSettings.ConfigFormat, cliSettings.ContentWorkingDir)
+	if err != nil {
+		return nil, err
+	}
+	config.settings = cliSettings
+	for _, warning := range config.Warnings() {
+		log.Warn(warning.Error())
+	}
 
 	if cliSettings.BaseURL != "" {
 		// Overwrite config base url if it is set as parameter
 		config.BaseURL = cliSettings.BaseURL
 	}
 
-	if !cliSettings.OnlyRender {
-		// Dont do these steps if only generate
-		config.CleanUp()
+	if !cliSettings.OnlyRender && !cliSettings.DryRun {
+		// Dont do these steps if only generate or planning
+		if !cliSettings.Incremental {
+			err = config.CleanUp()
+			if err != nil {
+				return nil, err
+			}
+		}
 
-		err := createMonakoStructureInHugoFolder(config, cliSettings.MenuConfigFilePath)
+		err = createMonakoStructureInHugoFolder(config, cliSettings.MenuConfigFilePath)
 		if err != nil {
-			log.Fatalf("Can't create Monako structure %s", err)
+			return nil, errors.Wrap(err, "Can't create Monako structure")
 		}
 	}
 
-	return config
+	return config, nil
+
+}
+
+// HugoError is returned by Generate if Hugo failed to render the site
+type HugoError struct {
+	Err error
+}
+
+func (err *HugoError) Error() string {
+	return err.Err.Error()
+}
+
+// Unwrap returns the error of Hugo
+func (err *HugoError) Unwrap() error {
+	return err.Err
+}
+
+// Build composes the Monako structure and renders it to HTML, depending on the settings
+// given to New. With DryRun only the plan is printed. Hugo errors are only returned if
+// FailOnHugoError is set, all other errors are always returned. Building stops if the context is done or the timeout of the
+// config is exceeded
+func (config *Config) Build(ctx context.Context) error {
+
+	if config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+	}
+
+	if config.settings.DryRun {
+		plan, err := config.Plan(ctx)
+		if err != nil {
+			return err
+		}
+		plan.Write(os.Stdout)
+		return nil
+	}
 
+	if !config.settings.OnlyRender {
+		err := config.Compose(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !config.settings.OnlyCompose {
+		err := config.Generate(ctx)
+		var hugoErr *HugoError
+		if errors.As(err, &hugoErr) && ctx.Err() == nil && !config.settings.FailOnHugoError {
+			log.Warnf("Ignoring Hugo error: %s", err)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-// Generate runs Hugo on the composed Monako source
-func (config *Config) Generate() error {
+// hugoRun runs Hugo with the arguments, it is replaced in tests
+var hugoRun = helpers.HugoRun
+
+// Generate runs Hugo on the composed Monako source. Hugo renders into a temporary folder
+// which replaces the public folder once Hugo is done. Hugo itself can't be interrupted,
+// so if the context is done while rendering, Generate waits for Hugo, discards the rendered
+// site and keeps the old public folder. The post render hooks run if Hugo rendered without
+// errors. Hugo errors are returned as HugoError
+func (config *Config) Generate(ctx context.Context) error {
 
 	if _, err := os.Stat(config.HugoWorkingDir); os.IsNotExist(err) {
-		log.Fatalf("%s does not exist, run monako -render before?", config.HugoWorkingDir)
+		return fmt.Errorf("%s does not exist, run monako -compose before?", config.HugoWorkingDir)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	err := helpers.HugoRun([]string{
+	renderDir, err := os.MkdirTemp(config.HugoWorkingDir, renderDirectoryPattern)
+	if err != nil {
+		return errors.Wrap(err, "Error creating render dir")
+	}
+
+	// The render dir is left over if Hugo rendered nothing or was interrupted
+	defer os.RemoveAll(renderDir)
+
+	hugoErr := hugoRun([]string{
 		// "-v",
 		"--source", config.HugoWorkingDir,
-		"--destination", "public",
+		"--destination", filepath.Base(renderDir),
 	})
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Hugo renders all other documents even if some have errors
+	if entries, err := ioutil.ReadDir(renderDir); err == nil && len(entries) > 0 {
+		publicDir := filepath.Join(config.HugoWorkingDir, publicDirectory)
+		if config.incremental() {
+			err = preserveModTimes(publicDir, renderDir)
+			if err != nil {
+				return errors.Wrap(err, "Error preserving modification times of unchanged pages")
+			}
+		}
+		err = os.RemoveAll(publicDir)
+		if err != nil {
+			return errors.Wrap(err, "Error removing old public dir")
+		}
+		err = os.Rename(renderDir, publicDir)
+		if err != nil {
+			return errors.Wrap(err, "Error moving rendered site to public dir")
+		}
+	}
+
+	if hugoErr != nil {
+		return &HugoError{Err: hugoErr}
+	}
+
+	err = config.addPagesToManifest()
 	if err != nil {
 		return err
 	}
-	return nil
+
+	return config.runHooks(ctx, PostRender)
 }
@@ -3,11 +3,16 @@ package compose
 // run: make benchmark
 
 import (
+	"context"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/Flaque/filet"
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/osfs"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -35,7 +40,7 @@ func TestGetTestConfig(t *testing.T) {
 func TestCompose(t *testing.T) {
 	config, _ := getTestConfig(t)
 
-	err := config.Compose()
+	err := config.Compose(context.Background())
 	assert.NoError(t, err)
 
 	wantFiles := []string{
@@ -65,7 +70,7 @@ func BenchmarkHugoRepositorySingleFiles(b *testing.B) {
 		DisableCommitInfo: false,
 	}
 
-	_, err := origin.CloneDir()
+	_, err := origin.Fetch(context.Background())
 	assert.NoError(b, err)
 
 	// Don't fetch commit info early
@@ -73,11 +78,11 @@ func BenchmarkHugoRepositorySingleFiles(b *testing.B) {
 	b.Run("Get Commit Info for Hugo", func(b *testing.B) {
 
 		for n := 0; n < b.N; n++ {
-			_, err := getCommitInfo("README.md", origin.repo)
+			_, err := origin.commits.CommitInfo(context.Background(), "README.md")
 			assert.NoError(b, err)
 
 			// Older commit long time no change, far behind in git log
-			_, err = getCommitInfo("docs/archetypes/default.md", origin.repo)
+			_, err = origin.commits.CommitInfo(context.Background(), "docs/archetypes/default.md")
 			assert.NoError(b, err)
 		}
 
@@ -114,18 +119,18 @@ func BenchmarkSlowRepositorySingleFiles(b *testing.B) {
 
 	// Don't fetch commit info early
 	origin.config = &Config{DisableCommitInfo: true}
-	_, err := origin.CloneDir()
+	_, err := origin.Fetch(context.Background())
 	assert.NoError(b, err)
 
 	b.Run("Get Commit Info", func(b *testing.B) {
 
 		for n := 0; n < b.N; n++ {
 
-			_, err := getCommitInfo(slowRepoFile1, origin.repo)
+			_, err := origin.commits.CommitInfo(context.Background(), slowRepoFile1)
 			assert.NoError(b, err)
 
 			// Older commit long time no change, far behind in git log
-			_, err = getCommitInfo(slowRepoFile2, origin.repo)
+			_, err = origin.commits.CommitInfo(context.Background(), slowRepoFile2)
 			assert.NoError(b, err)
 		}
 
@@ -149,14 +154,14 @@ func BenchmarkWholeRepoHugoRepositoryWholeRepo(b *testing.B) {
 	}
 
 	origin.FileWhitelist = origin.config.FileWhitelist
-	filesystem, err := origin.CloneDir()
+	filesystem, err := origin.Fetch(context.Background())
 	assert.NoError(b, err)
 
 	// Don't fetch commit info early
 	b.Run("Get Commit Info for Hugo", func(b *testing.B) {
 
 		for n := 0; n < b.N; n++ {
-			err := origin.ComposeDir(filesystem)
+			err := origin.ComposeDir(context.Background(), filesystem)
 			assert.NoError(b, err)
 		}
 
@@ -193,12 +198,12 @@ func BenchmarkWholeRepoSlowRepository(b *testing.B) {
 
 	origin.FileWhitelist = origin.config.FileWhitelist
 
-	filesystem, err := origin.CloneDir()
+	filesystem, err := origin.Fetch(context.Background())
 	assert.NoError(b, err)
 	b.Run("Get Commit Info", func(b *testing.B) {
 
 		for n := 0; n < b.N; n++ {
-			err := origin.ComposeDir(filesystem)
+			err := origin.ComposeDir(context.Background(), filesystem)
 			assert.NoError(b, err)
 		}
 
@@ -212,7 +217,7 @@ func TestDeactivatedCommitInfo(t *testing.T) {
 	assert.False(t, config.DisableCommitInfo)
 	config.DisableCommitInfo = true
 
-	err := config.Compose()
+	err := config.Compose(context.Background())
 	assert.NoError(t, err)
 
 	for i := range config.Origins[0].Files {
@@ -273,12 +278,28 @@ func getTestConfig(t *testing.T, origins ...Origin) (config *Config, tempdir str
 	return config, tempdir
 }
 
-func TestInit(t *testing.T) {
+// writeTestFiles writes the files with their content to a new temporary directory and returns it.
+// The local temp dir is within the Monako repository, so the temp dir of the system is used
+func writeTestFiles(t *testing.T, files map[string]string) string {
+	dir := filet.TmpDir(t, "")
+	for name, content := range files {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), standardFilemode))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), standardFilemode))
+	}
+	return dir
+}
+
+// newTestFilesystem returns a filesystem containing the given files, like the one of a fetched origin
+func newTestFilesystem(t *testing.T, files map[string]string) billy.Filesystem {
+	return osfs.New(writeTestFiles(t, files))
+}
+
+func TestNew(t *testing.T) {
 	localFolder := GetLocalTempDir(t)
 	commandLineBaseURL := "http://overwrite.config"
 	menuConfigFile := filet.TmpFile(t, os.TempDir(), "# Empty Menu")
 
-	config := Init(CommandLineSettings{
+	config, err := New(CommandLineSettings{
 		ConfigFilePath:     "../../test/config.local.yaml",
 		MenuConfigFilePath: menuConfigFile.Name(),
 		BaseURL:            commandLineBaseURL,
@@ -286,15 +307,154 @@ func TestInit(t *testing.T) {
 		FailOnHugoError:    true,
 		Trace:              true,
 	})
+	assert.NoError(t, err)
 
 	assert.NotNil(t, config)
 	assert.Equal(t, commandLineBaseURL, config.BaseURL)
 
 	t.Run("Generate HTML with Hugo", func(t *testing.T) {
 
-		err := config.Generate()
+		err := config.Generate(context.Background())
+		assert.NoError(t, err)
+
+		renderDirs, err := filepath.Glob(filepath.Join(config.HugoWorkingDir, renderDirectoryPattern))
+		assert.NoError(t, err)
+		assert.Empty(t, renderDirs, "Every run removes its own render dir")
+	})
+
+	t.Run("Deprecated Init", func(t *testing.T) {
+		config := Init(CommandLineSettings{
+			ConfigFilePath:     "../../test/config.local.yaml",
+			MenuConfigFilePath: menuConfigFile.Name(),
+			ContentWorkingDir:  GetLocalTempDir(t),
+		})
+		assert.NotNil(t, config)
+		assert.DirExists(t, config.HugoWorkingDir)
+	})
+
+	t.Run("Return error for invalid config", func(t *testing.T) {
+		_, err := New(CommandLineSettings{
+			ConfigFilePath:    "missing path",
+			ContentWorkingDir: localFolder,
+		})
+		assert.Error(t, err)
+	})
+
+	t.Run("Return error for missing menu", func(t *testing.T) {
+		_, err := New(CommandLineSettings{
+			ConfigFilePath:     "../../test/config.local.yaml",
+			MenuConfigFilePath: "missing path",
+			ContentWorkingDir:  localFolder,
+		})
+		assert.Error(t, err)
+	})
+
+}
+
+func TestBuild(t *testing.T) {
+
+	t.Run("Only compose", func(t *testing.T) {
+		config, _ := getTestConfig(t)
+		config.settings = CommandLineSettings{OnlyCompose: true}
+
+		err := config.Build(context.Background())
 		assert.NoError(t, err)
+		assert.FileExists(t, filepath.Join(config.ContentWorkingDir, "docs/monako-test/README.md"))
+		assert.NoDirExists(t, filepath.Join(config.HugoWorkingDir, "public"))
+	})
+
+	t.Run("Render without compose", func(t *testing.T) {
+		config, _ := getTestConfig(t)
+		config.settings = CommandLineSettings{OnlyRender: true, FailOnHugoError: true}
+
+		err := config.Build(context.Background())
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "does not exist")
+
+		config.settings.FailOnHugoError = false
+		assert.Error(t, config.Build(context.Background()), "A missing compose folder is not a Hugo error")
+	})
+
+	t.Run("Cancelled context", func(t *testing.T) {
+		config, _ := getTestConfig(t)
+		assert.NoError(t, config.createWorkingDir())
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
 
+		err := config.Build(ctx)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.NoDirExists(t, config.HugoWorkingDir, "Incomplete compose folder is removed")
 	})
 
+	t.Run("Failed incremental compose", func(t *testing.T) {
+		first := writeTestFiles(t, map[string]string{"README.md": "# Readme"})
+		config, _ := getTestConfig(t, Origin{Type: LocalSource, URL: first, TargetDir: "first"})
+		config.settings = CommandLineSettings{Incremental: true, OnlyCompose: true}
+		assert.NoError(t, config.Build(context.Background()))
+
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(first, "new.md"), []byte("# New"), standardFilemode))
+		config.Origins = append(config.Origins, Origin{Type: LocalSource, URL: filepath.Join(first, "missing"), TargetDir: "second", config: config})
+		config.Origins[0].Files = nil
+
+		assert.Error(t, config.Build(context.Background()))
+		assert.FileExists(t, filepath.Join(config.ContentWorkingDir, "first/README.md"), "Files of the last build are kept")
+		assert.NoFileExists(t, filepath.Join(config.ContentWorkingDir, "first/new.md"), "Files of the failed build are removed")
+		assert.FileExists(t, config.statePath())
+	})
+
+	t.Run("Origin timeout exceeded", func(t *testing.T) {
+		config, _ := getTestConfig(t)
+		config.Origins[0].Timeout = time.Nanosecond
+		config.settings = CommandLineSettings{OnlyCompose: true}
+
+		err := config.Build(context.Background())
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("Failing post render hook", func(t *testing.T) {
+		config, err := New(CommandLineSettings{
+			ConfigFilePath:     "../../test/config.local.yaml",
+			MenuConfigFilePath: filet.TmpFile(t, os.TempDir(), "# Empty Menu").Name(),
+			ContentWorkingDir:  GetLocalTempDir(t),
+		})
+		assert.NoError(t, err)
+		config.settings.OnlyRender = true
+		config.Hooks.PostRender = []Hook{{Command: []string{"sh", "-c", "exit 1"}, FailOnError: true}}
+
+		err = config.Build(context.Background())
+		assert.Error(t, err, "Hook errors don't depend on FailOnHugoError")
+		assert.Contains(t, err.Error(), "postRender hook sh failed")
+	})
+
+	t.Run("Render with cancelled context keeps public dir", func(t *testing.T) {
+		config, _ := getTestConfig(t)
+		publicDir := filepath.Join(config.HugoWorkingDir, publicDirectory)
+		assert.NoError(t, os.MkdirAll(publicDir, standardFilemode))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		err := config.Generate(ctx)
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.DirExists(t, publicDir)
+		renderDirs, err := filepath.Glob(filepath.Join(config.HugoWorkingDir, renderDirectoryPattern))
+		assert.NoError(t, err)
+		assert.Empty(t, renderDirs)
+
+		t.Run("While rendering", func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer func(run func([]string) error) { hugoRun = run }(hugoRun)
+			hugoRun = func(args []string) error {
+				cancel()
+				return ioutil.WriteFile(filepath.Join(config.HugoWorkingDir, args[3], "index.html"), []byte("new"), standardFilemode)
+			}
+
+			err := config.Generate(ctx)
+			assert.ErrorIs(t, err, context.Canceled)
+			assert.NoFileExists(t, filepath.Join(publicDir, "index.html"))
+			renderDirs, err := filepath.Glob(filepath.Join(config.HugoWorkingDir, renderDirectoryPattern))
+			assert.NoError(t, err)
+			assert.Empty(t, renderDirs, "Render dir is removed after Hugo finished")
+		})
+	})
 }
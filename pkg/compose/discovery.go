@@ -0,0 +1,434 @@
+package compose
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// GitHub is the discovery provider for GitHub and GitHub Enterprise
+const GitHub = "github"
+
+// GitLab is the discovery provider for GitLab
+const GitLab = "gitlab"
+
+// Gitea is the discovery provider for Gitea and Forgejo
+const Gitea = "gitea"
+
+// discoveryPageSize is the number of repositories requested per API call
+const discoveryPageSize = 100
+
+// Discovery describes how to find origins in an organization of a Git hosting provider.
+// An origin with a discovery is used as a template for all repositories found
+type Discovery struct {
+	// Provider is the Git hosting provider, one of github, gitlab or gitea
+	Provider string `yaml:"provider"`
+	// API is the base URL of the API, for example "https://api.github.com"
+	API string `yaml:"api,omitempty"`
+	// Organization is the organization, user or group to search in
+	Organization string `yaml:"org"`
+	// Topic only selects repositories with this topic
+	Topic string `yaml:"topic,omitempty"`
+	// Name is a regular expression repository names have to match
+	Name string `yaml:"name,omitempty"`
+	// EnvToken is the environment variable containing the API token
+	EnvToken string `yaml:"envtoken,omitempty"`
+}
+
+// discoveredRepository is a repository found by a discovery provider
+type discoveredRepository struct {
+	Name string
+	// FullName is the path of the repository including the organization and all subgroups
+	FullName      string
+	CloneURL      string
+	DefaultBranch string
+	Topics        []string
+	Archived      bool
+}
+
+// discoveryProvider lists repositories of an organization at a Git hosting provider
+type discoveryProvider interface {
+	// defaultAPI is the API base URL used if none is configured
+	defaultAPI() string
+	// repositoriesURL returns the API URL for a page of repositories of the organization
+	repositoriesURL(discovery *Discovery, page int) string
+	// parseRepositories parses an API response of repositoriesURL
+	parseRepositories(body []byte) ([]discoveredRepository, error)
+	// directoryURL returns the API URL that exists if the repository contains the directory
+	directoryURL(discovery *Discovery, repository discoveredRepository, branch string, dir string) string
+	// authorize adds the API token to the request
+	authorize(request *http.Request, token string)
+}
+
+var discoveryProviders = map[string]discoveryProvider{
+	GitHub: githubDiscovery{},
+	GitLab: gitlabDiscovery{},
+	Gitea:  giteaDiscovery{},
+}
+
+// DiscoverOrigins replaces all origins with a discovery by one origin for each repository
+// found. Repositories without the docdir of the origin or already configured as origin
+// are skipped
+func (config *Config) DiscoverOrigins(ctx context.Context) error {
+
+	configured := make(map[string]bool)
+	for _, origin := range config.Origins {
+		if origin.Discover == nil {
+			configured[strings.TrimSuffix(origin.URL, ".git")] = true
+		}
+	}
+
+	var origins []Origin
+	discoveredIndexes := make(map[int]bool)
+	for _, origin := range config.Origins {
+		if origin.Discover == nil {
+			origins = append(origins, origin)
+			continue
+		}
+
+		discovered, err := origin.discover(ctx)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Error discovering origins in %s %s", origin.Discover.Provider, origin.Discover.Organization))
+		}
+
+		for _, discoveredOrigin := range discovered {
+			if configured[strings.TrimSuffix(discoveredOrigin.URL, ".git")] {
+				log.Infof("Skipping discovered origin %s, it is already configured", discoveredOrigin.URL)
+				continue
+			}
+			discoveredIndexes[len(origins)] = true
+			origins = append(origins, discoveredOrigin)
+		}
+	}
+
+	// Configured origins have been checked by Validate
+	for _, overlap := range config.findTargetDirOverlaps(origins) {
+		if !discoveredIndexes[overlap.origin] && !discoveredIndexes[overlap.other] {
+			continue
+		}
+		origin, other := origins[overlap.origin], origins[overlap.other]
+		if overlap.same {
+			return fmt.Errorf("targetdir %q of %s is the same as the one of %s, set collisions to allow it", origin.TargetDir, origin.URL, other.URL)
+		}
+		log.Warnf("targetdir %q of %s is nested with targetdir %q of %s, files at the same path collide", origin.TargetDir, origin.URL, other.TargetDir, other.URL)
+	}
+
+	config.Origins = origins
+	for i := range config.Origins {
+		config.Origins[i].config = config
+	}
+	return nil
+}
+
+// discover returns an origin for every repository matching the discovery of this origin
+func (origin *Origin) discover(ctx context.Context) ([]Origin, error) {
+	discovery := origin.Discover
+
+	provider, isKnown := discoveryProviders[discovery.Provider]
+	if !isKnown {
+		return nil, fmt.Errorf("unknown discovery provider %q", discovery.Provider)
+	}
+
+	client := &discoveryClient{
+		provider: provider,
+		token:    os.Getenv(discovery.EnvToken),
+		http:     &http.Client{Timeout: 30 * time.Second},
+	}
+
+	var nameFilter *regexp.Regexp
+	if discovery.Name != "" {
+		var err error
+		nameFilter, err = regexp.Compile(discovery.Name)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error compiling name filter")
+		}
+	}
+
+	fmt.Printf("\nDiscovering origins in %s '%s' ...\n", discovery.Provider, discovery.Organization)
+
+	repositories, err := client.repositories(ctx, discovery)
+	if err != nil {
+		return nil, err
+	}
+
+	var origins []Origin
+	for _, repository := range repositories {
+		if repository.Archived ||
+			(nameFilter != nil && !nameFilter.MatchString(repository.Name)) ||
+			(discovery.Topic != "" && !containsString(repository.Topics, discovery.Topic)) {
+			continue
+		}
+
+		branch := origin.Branch
+		if branch == "" {
+			branch = repository.DefaultBranch
+		}
+
+		hasDocDir, err := client.hasDirectory(ctx, discovery, repository, branch, origin.SourceDir)
+		if err != nil {
+			return nil, err
+		}
+		if !hasDocDir {
+			log.Debugf("Skipping discovered repository %s, it has no directory '%s'", repository.Name, origin.SourceDir)
+			continue
+		}
+
+		discovered := *origin
+		discovered.Discover = nil
+		discovered.URL = repository.CloneURL
+		discovered.Branch = branch
+		discovered.TargetDir = expandTargetDirTemplate(origin.TargetDir, discovery.Organization, repository.path(discovery.Organization))
+		origins = append(origins, discovered)
+
+		fmt.Printf("Discovered %s -> %s\n", discovered.URL, discovered.TargetDir)
+	}
+
+	return origins, nil
+}
+
+// path returns the path of the repository within the organization, which contains the subgroups
+// of GitLab projects
+func (repository discoveredRepository) path(organization string) string {
+	if repository.FullName == "" {
+		return repository.Name
+	}
+	return strings.TrimPrefix(repository.FullName, organization+"/")
+}
+
+// expandTargetDirTemplate replaces {org} and {repo} in the targetdir of a discovery origin
+func expandTargetDirTemplate(targetDir string, organization string, repository string) string {
+	return strings.NewReplacer("{org}", organization, "{repo}", repository).Replace(targetDir)
+}
+
+func containsString(list []string, value string) bool {
+	for _, element := range list {
+		if element == value {
+			return true
+		}
+	}
+	return false
+}
+
+// discoveryClient executes the API calls of a discovery provider
+type discoveryClient struct {
+	provider discoveryProvider
+	token    string
+	http     *http.Client
+}
+
+// repositories returns all repositories of the organization sorted by their path
+func (client *discoveryClient) repositories(ctx context.Context, discovery *Discovery) ([]discoveredRepository, error) {
+	var repositories []discoveredRepository
+
+	for page := 1; ; page++ {
+		status, body, err := client.get(ctx, client.provider.repositoriesURL(discovery, page))
+		if err != nil {
+			return nil, err
+		}
+		if status != http.StatusOK {
+			return nil, fmt.Errorf("listing repositories of '%s' returned HTTP %d: %s", discovery.Organization, status, body)
+		}
+
+		pageRepositories, err := client.provider.parseRepositories(body)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error parsing repositories")
+		}
+		// Providers may return less repositories than requested per page, for example Gitea
+		// is limited to 50 by default. The last page is the first empty one
+		if len(pageRepositories) == 0 {
+			break
+		}
+		repositories = append(repositories, pageRepositories...)
+	}
+
+	sort.Slice(repositories, func(i, j int) bool {
+		return repositories[i].path(discovery.Organization) < repositories[j].path(discovery.Organization)
+	})
+	return repositories, nil
+}
+
+// hasDirectory returns true if the repository contains the directory in the branch
+func (client *discoveryClient) hasDirectory(ctx context.Context, discovery *Discovery, repository discoveredRepository, branch string, dir string) (bool, error) {
+	dir = strings.Trim(path.Clean("/"+dir), "/")
+	if dir == "" {
+		return true, nil
+	}
+
+	status, body, err := client.get(ctx, client.provider.directoryURL(discovery, repository, branch, dir))
+	if err != nil {
+		return false, err
+	}
+	switch status {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("checking directory '%s' of %s returned HTTP %d: %s", dir, repository.Name, status, body)
+	}
+}
+
+func (client *discoveryClient) get(ctx context.Context, apiURL string) (int, []byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	if client.token != "" {
+		client.provider.authorize(request, client.token)
+	}
+
+	log.Debugf("Discovery request %s", apiURL)
+	response, err := client.http.Do(request)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, fmt.Sprintf("Error requesting %s", apiURL))
+	}
+	defer response.Body.Close()
+
+	var body json.RawMessage
+	err = json.NewDecoder(response.Body).Decode(&body)
+	if err != nil && response.StatusCode == http.StatusOK {
+		return 0, nil, errors.Wrap(err, fmt.Sprintf("Error reading response of %s", apiURL))
+	}
+	return response.StatusCode, body, nil
+}
+
+func apiBase(discovery *Discovery, provider discoveryProvider) string {
+	if discovery.API != "" {
+		return strings.TrimSuffix(discovery.API, "/")
+	}
+	return provider.defaultAPI()
+}
+
+type githubDiscovery struct{}
+
+func (githubDiscovery) defaultAPI() string {
+	return "https://api.github.com"
+}
+
+func (provider githubDiscovery) repositoriesURL(discovery *Discovery, page int) string {
+	return fmt.Sprintf("%s/orgs/%s/repos?per_page=%d&page=%d",
+		apiBase(discovery, provider), url.PathEscape(discovery.Organization), discoveryPageSize, page)
+}
+
+func (githubDiscovery) parseRepositories(body []byte) ([]discoveredRepository, error) {
+	var response []struct {
+		Name          string   `json:"name"`
+		FullName      string   `json:"full_name"`
+		CloneURL      string   `json:"clone_url"`
+		DefaultBranch string   `json:"default_branch"`
+		Topics        []string `json:"topics"`
+		Archived      bool     `json:"archived"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+
+	repositories := make([]discoveredRepository, len(response))
+	for i, r := range response {
+		repositories[i] = discoveredRepository(r)
+	}
+	return repositories, nil
+}
+
+func (provider githubDiscovery) directoryURL(discovery *Discovery, repository discoveredRepository, branch string, dir string) string {
+	return fmt.Sprintf("%s/repos/%s/%s/contents/%s?ref=%s",
+		apiBase(discovery, provider), url.PathEscape(discovery.Organization), url.PathEscape(repository.Name),
+		escapePath(dir), url.QueryEscape(branch))
+}
+
+func (githubDiscovery) authorize(request *http.Request, token string) {
+	request.Header.Set("Authorization", "token "+token)
+}
+
+type gitlabDiscovery struct{}
+
+func (gitlabDiscovery) defaultAPI() string {
+	return "https://gitlab.com/api/v4"
+}
+
+func (provider gitlabDiscovery) repositoriesURL(discovery *Discovery, page int) string {
+	apiURL := fmt.Sprintf("%s/groups/%s/projects?include_subgroups=true&per_page=%d&page=%d",
+		apiBase(discovery, provider), url.PathEscape(discovery.Organization), discoveryPageSize, page)
+	if discovery.Topic != "" {
+		apiURL += "&topic=" + url.QueryEscape(discovery.Topic)
+	}
+	return apiURL
+}
+
+func (gitlabDiscovery) parseRepositories(body []byte) ([]discoveredRepository, error) {
+	var response []struct {
+		Path          string   `json:"path"`
+		FullPath      string   `json:"path_with_namespace"`
+		CloneURL      string   `json:"http_url_to_repo"`
+		DefaultBranch string   `json:"default_branch"`
+		Topics        []string `json:"topics"`
+		TagList       []string `json:"tag_list"`
+		Archived      bool     `json:"archived"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+
+	repositories := make([]discoveredRepository, len(response))
+	for i, r := range response {
+		repositories[i] = discoveredRepository{
+			Name:          r.Path,
+			FullName:      r.FullPath,
+			CloneURL:      r.CloneURL,
+			DefaultBranch: r.DefaultBranch,
+			// Older GitLab versions call topics tags
+			Topics:   append(r.Topics, r.TagList...),
+			Archived: r.Archived,
+		}
+	}
+	return repositories, nil
+}
+
+func (provider gitlabDiscovery) directoryURL(discovery *Discovery, repository discoveredRepository, branch string, dir string) string {
+	project := url.PathEscape(repository.FullName)
+	return fmt.Sprintf("%s/projects/%s/repository/tree?path=%s&ref=%s&per_page=1",
+		apiBase(discovery, provider), project, url.QueryEscape(dir), url.QueryEscape(branch))
+}
+
+func (gitlabDiscovery) authorize(request *http.Request, token string) {
+	request.Header.Set("PRIVATE-TOKEN", token)
+}
+
+type giteaDiscovery struct {
+	githubDiscovery
+}
+
+func (giteaDiscovery) defaultAPI() string {
+	return "https://gitea.com/api/v1"
+}
+
+func (provider giteaDiscovery) repositoriesURL(discovery *Discovery, page int) string {
+	return fmt.Sprintf("%s/orgs/%s/repos?limit=%d&page=%d",
+		apiBase(discovery, provider), url.PathEscape(discovery.Organization), discoveryPageSize, page)
+}
+
+func (provider giteaDiscovery) directoryURL(discovery *Discovery, repository discoveredRepository, branch string, dir string) string {
+	return fmt.Sprintf("%s/repos/%s/%s/contents/%s?ref=%s",
+		apiBase(discovery, provider), url.PathEscape(discovery.Organization), url.PathEscape(repository.Name),
+		escapePath(dir), url.QueryEscape(branch))
+}
+
+// escapePath escapes all elements of a slash separated path
+func escapePath(p string) string {
+	elements := strings.Split(p, "/")
+	for i := range elements {
+		elements[i] = url.PathEscape(elements[i])
+	}
+	return strings.Join(elements, "/")
+}
@@ -0,0 +1,277 @@
+package compose
+
+// run: go test ./pkg/compose -run TestDiscover
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newDiscoveryTestServer returns a stand-in for the APIs of GitHub, GitLab and Gitea with the
+// repositories "docs-a", "docs-b", "service-c" and "docs-archived". Only "docs-a" and "service-c"
+// contain a "docs" directory. Repositories are listed on pages of two, regardless of the requested size
+func newDiscoveryTestServer(t *testing.T) *httptest.Server {
+
+	type githubRepo struct {
+		Name          string   `json:"name"`
+		CloneURL      string   `json:"clone_url"`
+		DefaultBranch string   `json:"default_branch"`
+		Topics        []string `json:"topics"`
+		Archived      bool     `json:"archived"`
+	}
+	type gitlabRepo struct {
+		Path          string   `json:"path"`
+		FullPath      string   `json:"path_with_namespace"`
+		CloneURL      string   `json:"http_url_to_repo"`
+		DefaultBranch string   `json:"default_branch"`
+		TagList       []string `json:"tag_list"`
+		Archived      bool     `json:"archived"`
+	}
+
+	githubRepos := []githubRepo{
+		{"docs-b", "https://git.example.com/org/docs-b.git", "main", []string{"docs"}, false},
+		{"docs-a", "https://git.example.com/org/docs-a.git", "master", []string{"docs"}, false},
+		{"service-c", "https://git.example.com/org/service-c.git", "develop", nil, false},
+		{"docs-archived", "https://git.example.com/org/docs-archived.git", "master", []string{"docs"}, true},
+	}
+	var gitlabRepos []gitlabRepo
+	for _, r := range githubRepos {
+		gitlabRepos = append(gitlabRepos, gitlabRepo{r.Name, "org/" + r.Name, r.CloneURL, r.DefaultBranch, r.Topics, r.Archived})
+	}
+	// Projects of subgroups can have the same name as projects of the group
+	gitlabRepos = append(gitlabRepos, gitlabRepo{"docs-a", "org/sub/docs-a", "https://git.example.com/org/sub/docs-a.git", "main", nil, false})
+
+	withDocs := map[string]bool{"docs-a": true, "service-c": true}
+
+	writeJSON := func(w http.ResponseWriter, value interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		assert.NoError(t, json.NewEncoder(w).Encode(value))
+	}
+
+	// page returns the range of the repositories on the requested page
+	page := func(r *http.Request, count int) (int, int) {
+		number, err := strconv.Atoi(r.URL.Query().Get("page"))
+		assert.NoError(t, err)
+		start, end := (number-1)*2, number*2
+		if start > count {
+			start = count
+		}
+		if end > count {
+			end = count
+		}
+		return start, end
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/github/orgs/org/repos", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "token secret", r.Header.Get("Authorization"))
+		start, end := page(r, len(githubRepos))
+		writeJSON(w, githubRepos[start:end])
+	})
+	mux.HandleFunc("/gitea/orgs/org/repos", func(w http.ResponseWriter, r *http.Request) {
+		start, end := page(r, len(githubRepos))
+		writeJSON(w, githubRepos[start:end])
+	})
+	mux.HandleFunc("/gitlab/groups/org/projects", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.Header.Get("PRIVATE-TOKEN"))
+		start, end := page(r, len(gitlabRepos))
+		writeJSON(w, gitlabRepos[start:end])
+	})
+
+	contents := func(w http.ResponseWriter, r *http.Request) {
+		// /<provider>/repos/org/<repo>/contents/docs
+		elements := strings.Split(r.URL.Path, "/")
+		if withDocs[elements[4]] && strings.HasSuffix(r.URL.Path, "/contents/docs") {
+			writeJSON(w, []interface{}{})
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(w, map[string]string{"message": "Not Found"})
+	}
+	mux.HandleFunc("/github/repos/", contents)
+	mux.HandleFunc("/gitea/repos/", contents)
+	mux.HandleFunc("/gitlab/projects/", func(w http.ResponseWriter, r *http.Request) {
+		// /gitlab/projects/org%2F<subgroup>%2F<repo>/repository/tree
+		project, err := url.PathUnescape(strings.Split(r.URL.EscapedPath(), "/")[3])
+		assert.NoError(t, err)
+		if (withDocs[strings.TrimPrefix(project, "org/")] || project == "org/sub/docs-a") && r.URL.Query().Get("path") == "docs" {
+			writeJSON(w, []interface{}{})
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		writeJSON(w, map[string]string{"message": "404 Tree Not Found"})
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func TestDiscoverOrigins(t *testing.T) {
+
+	server := newDiscoveryTestServer(t)
+	defer server.Close()
+
+	os.Setenv("MONAKO_TEST_DISCOVERY_TOKEN", "secret")
+	defer os.Unsetenv("MONAKO_TEST_DISCOVERY_TOKEN")
+
+	for _, provider := range []string{GitHub, GitLab, Gitea} {
+		t.Run(fmt.Sprintf("Discover in %s", provider), func(t *testing.T) {
+			config, _ := getTestConfig(t, Origin{
+				SourceDir: "docs",
+				TargetDir: "docs/{org}/{repo}",
+				Discover: &Discovery{
+					Provider:     provider,
+					API:          server.URL + "/" + provider,
+					Organization: "org",
+					EnvToken:     "MONAKO_TEST_DISCOVERY_TOKEN",
+				},
+			})
+
+			err := config.DiscoverOrigins(context.Background())
+			assert.NoError(t, err)
+
+			if provider == GitLab {
+				assert.Len(t, config.Origins, 3)
+				assert.Equal(t, "https://git.example.com/org/sub/docs-a.git", config.Origins[2].URL)
+				assert.Equal(t, "docs/org/sub/docs-a", config.Origins[2].TargetDir)
+			} else {
+				assert.Len(t, config.Origins, 2)
+			}
+			assert.Equal(t, "https://git.example.com/org/docs-a.git", config.Origins[0].URL)
+			assert.Equal(t, "master", config.Origins[0].Branch)
+			assert.Equal(t, "docs/org/docs-a", config.Origins[0].TargetDir)
+			assert.Equal(t, "docs", config.Origins[0].SourceDir)
+			assert.Nil(t, config.Origins[0].Discover)
+			assert.Equal(t, config, config.Origins[0].config)
+
+			assert.Equal(t, "https://git.example.com/org/service-c.git", config.Origins[1].URL)
+			assert.Equal(t, "develop", config.Origins[1].Branch)
+			assert.Equal(t, "docs/org/service-c", config.Origins[1].TargetDir)
+		})
+	}
+
+	t.Run("Filter by topic and name", func(t *testing.T) {
+		config, _ := getTestConfig(t, Origin{
+			Branch:    "release",
+			TargetDir: "docs/{repo}",
+			Discover: &Discovery{
+				Provider:     GitHub,
+				API:          server.URL + "/github/",
+				Organization: "org",
+				EnvToken:     "MONAKO_TEST_DISCOVERY_TOKEN",
+				Topic:        "docs",
+				Name:         "^docs-[ab]$",
+			},
+		})
+
+		err := config.DiscoverOrigins(context.Background())
+		assert.NoError(t, err)
+
+		assert.Len(t, config.Origins, 2)
+		assert.Equal(t, "docs/docs-a", config.Origins[0].TargetDir)
+		assert.Equal(t, "docs/docs-b", config.Origins[1].TargetDir)
+		assert.Equal(t, "release", config.Origins[1].Branch)
+	})
+
+	t.Run("Explicitly configured origins are kept", func(t *testing.T) {
+		config, _ := getTestConfig(t,
+			*NewOrigin("https://git.example.com/org/docs-a", "master", ".", "docs/a"),
+			Origin{
+				SourceDir: "docs",
+				TargetDir: "docs/{repo}",
+				Discover: &Discovery{
+					Provider:     GitHub,
+					API:          server.URL + "/github",
+					Organization: "org",
+					EnvToken:     "MONAKO_TEST_DISCOVERY_TOKEN",
+				},
+			})
+
+		err := config.DiscoverOrigins(context.Background())
+		assert.NoError(t, err)
+
+		assert.Len(t, config.Origins, 2)
+		assert.Equal(t, "docs/a", config.Origins[0].TargetDir)
+		assert.Equal(t, "docs/service-c", config.Origins[1].TargetDir)
+	})
+
+	t.Run("Overlapping targetdirs", func(t *testing.T) {
+		discovery := Origin{
+			TargetDir: "docs",
+			Discover: &Discovery{
+				Provider:     GitHub,
+				API:          server.URL + "/github",
+				Organization: "org",
+				EnvToken:     "MONAKO_TEST_DISCOVERY_TOKEN",
+			},
+		}
+		config, _ := getTestConfig(t, discovery)
+		err := config.DiscoverOrigins(context.Background())
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), `targetdir "docs" of https://git.example.com/org/docs-b.git is the same as the one of https://git.example.com/org/docs-a.git`)
+
+		discovery.TargetDir = "docs/{repo}"
+		config, _ = getTestConfig(t, *NewOrigin("https://git.example.com/org/static", "master", ".", "docs"), discovery)
+		assert.NoError(t, config.DiscoverOrigins(context.Background()), "Nested targetdirs are a warning")
+
+		config, _ = getTestConfig(t, *NewOrigin("https://git.example.com/org/static", "master", ".", "docs/docs-a"), discovery)
+		assert.Error(t, config.DiscoverOrigins(context.Background()))
+
+		config.Collisions = CollisionSuffix
+		config.Origins = []Origin{*NewOrigin("https://git.example.com/org/static", "master", ".", "docs/docs-a"), discovery}
+		assert.NoError(t, config.DiscoverOrigins(context.Background()), "Identical targetdirs are allowed with a policy")
+	})
+
+	t.Run("API error", func(t *testing.T) {
+		config, _ := getTestConfig(t, Origin{
+			TargetDir: "docs/{repo}",
+			Discover: &Discovery{
+				Provider:     GitHub,
+				API:          server.URL + "/github",
+				Organization: "unknown",
+			},
+		})
+		assert.Error(t, config.DiscoverOrigins(context.Background()))
+	})
+}
+
+func TestValidateDiscovery(t *testing.T) {
+	configFile := writeTestConfig(t, `
+origins:
+  - src: https://github.com/snipem/monako-test.git
+    targetdir: docs/static
+    discover:
+      provider: bitbucket
+      name: "docs-("
+  - branch: master
+    targetdir: docs/{repo}
+    discover:
+      provider: github
+      org: snipem
+`)
+	_, err := LoadConfig(configFile, "")
+	assert.Error(t, err)
+	errs := err.(ConfigErrors)
+
+	var fields []string
+	for _, e := range errs {
+		fields = append(fields, e.Field)
+	}
+	assert.Equal(t, []string{
+		"origins[0].src",
+		"origins[0].discover.provider",
+		"origins[0].discover.org",
+		"origins[0].discover.name",
+		"origins[0].targetdir",
+	}, fields)
+	assert.Equal(t, 6, errs[1].Line)
+}
@@ -0,0 +1,358 @@
+package compose
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// GitSource identifies origins cloned from a Git repository. This is the default type
+const GitSource = "git"
+
+// LocalSource identifies origins read from a local directory
+const LocalSource = "local"
+
+// ArchiveSource identifies origins extracted from a zip or tar archive, stored locally or on a HTTP server
+const ArchiveSource = "archive"
+
+// HTTPSource identifies origins consisting of a single document downloaded via HTTP
+const HTTPSource = "http"
+
+// Fetcher fetches the content of an origin
+type Fetcher interface {
+	// Fetch returns a filesystem containing the content of the origin. The returned CommitInfoProvider
+	// is used for adding commit information to documents, it is nil if the source has no history
+	Fetch(ctx context.Context, origin *Origin) (billy.Filesystem, CommitInfoProvider, error)
+}
+
+// FetcherFunc is an adapter to use ordinary functions as Fetcher
+type FetcherFunc func(ctx context.Context, origin *Origin) (billy.Filesystem, CommitInfoProvider, error)
+
+// Fetch calls f(ctx, origin)
+func (f FetcherFunc) Fetch(ctx context.Context, origin *Origin) (billy.Filesystem, CommitInfoProvider, error) {
+	return f(ctx, origin)
+}
+
+// CommitInfoProvider returns the commit information of files fetched by a Fetcher
+type CommitInfoProvider interface {
+	// CommitInfo returns the last commit of the file at remotePath
+	CommitInfo(ctx context.Context, remotePath string) (*OriginFileCommit, error)
+}
+
+// RevisionProvider is implemented by CommitInfoProviders knowing the fetched revision
+type RevisionProvider interface {
+	// Revision returns the fetched reference, for example refs/heads/master, and its commit hash
+	Revision() (ref string, commit string)
+}
+
+var fetchersMutex sync.RWMutex
+
+// fetchers contains the registered fetchers by origin type
+var fetchers = map[string]Fetcher{
+	GitSource:     FetcherFunc(fetchGit),
+	LocalSource:   FetcherFunc(fetchLocal),
+	ArchiveSource: FetcherFunc(fetchArchive),
+	HTTPSource:    FetcherFunc(fetchHTTP),
+}
+
+// RegisterFetcher registers the fetcher for origins of the given type. Registering a fetcher
+// for an existing type replaces it. Fetchers have to be registered before the config is loaded
+func RegisterFetcher(originType string, fetcher Fetcher) {
+	fetchersMutex.Lock()
+	defer fetchersMutex.Unlock()
+	fetchers[originType] = fetcher
+}
+
+// getFetcher returns the fetcher registered for the origin type. Origins without type are Git origins
+func getFetcher(originType string) (Fetcher, bool) {
+	if originType == "" {
+		originType = GitSource
+	}
+	fetchersMutex.RLock()
+	defer fetchersMutex.RUnlock()
+	fetcher, isRegistered := fetchers[originType]
+	return fetcher, isRegistered
+}
+
+// registeredFetcherTypes returns the sorted types of all registered fetchers
+func registeredFetcherTypes() []string {
+	fetchersMutex.RLock()
+	defer fetchersMutex.RUnlock()
+	var types []string
+	for originType := range fetchers {
+		types = append(types, originType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Fetch fetches the content of the origin with the fetcher registered for its type.
+// A virtual filesystem is returned containing the fetched files. Fetching is aborted
+// if the context is done
+func (origin *Origin) Fetch(ctx context.Context) (billy.Filesystem, error) {
+
+	fetcher, isRegistered := getFetcher(origin.Type)
+	if !isRegistered {
+		return nil, fmt.Errorf("no fetcher registered for origin type %q", origin.Type)
+	}
+
+	filesystem, commits, err := fetcher.Fetch(ctx, origin)
+	if err != nil {
+		return nil, err
+	}
+
+	origin.commits = commits
+	if revisions, isRevisionProvider := commits.(RevisionProvider); isRevisionProvider {
+		origin.ref, origin.commit = revisions.Revision()
+	}
+	return filesystem, nil
+}
+
+// gitCommitInfo provides the commit information of a Git repository. All paths are prefixed with
+// prefix, which is the path of the fetched directory within the repository
+type gitCommitInfo struct {
+	repo   *git.Repository
+	prefix string
+
+	// mailmap maps the authors of the repository, read once on the first history
+	mailmap     mailmap
+	mailmapOnce sync.Once
+
+	// codeowners maps files to their owners, read once on the first lookup
+	codeowners     codeowners
+	codeownersOnce sync.Once
+}
+
+// CommitInfo returns the last commit of the file at remotePath
+func (commits *gitCommitInfo) CommitInfo(ctx context.Context, remotePath string) (*OriginFileCommit, error) {
+	return getCommitInfo(ctx, path.Join(commits.prefix, remotePath), commits.repo)
+}
+
+// Revision returns the checked out reference of the repository and its commit hash
+func (commits *gitCommitInfo) Revision() (string, string) {
+	head, err := commits.repo.Head()
+	if err != nil {
+		return "", ""
+	}
+	return head.Name().String(), head.Hash().String()
+}
+
+// fetchLocal returns the local directory given as src. If the directory is part of a Git repository,
+// its history is used for commit information
+func fetchLocal(ctx context.Context, origin *Origin) (billy.Filesystem, CommitInfoProvider, error) {
+
+	dir, err := filepath.Abs(origin.URL)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, fmt.Sprintf("Error reading local directory %s", origin.URL))
+	}
+	if !info.IsDir() {
+		return nil, nil, fmt.Errorf("%s is not a directory", origin.URL)
+	}
+
+	fmt.Printf("\nReading local directory '%s' ...\n", origin.URL)
+
+	repo, err := git.PlainOpenWithOptions(dir, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		log.Debugf("%s is not part of a Git repository, no commit info available: %s", dir, err)
+		return osfs.New(dir), nil, nil
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return osfs.New(dir), nil, nil
+	}
+	prefix, err := filepath.Rel(worktree.Filesystem.Root(), dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return osfs.New(dir), &gitCommitInfo{repo: repo, prefix: filepath.ToSlash(prefix)}, nil
+}
+
+// fetchArchive extracts the zip or tar archive given as src into a virtual filesystem.
+// The archive can be a local file or a HTTP URL
+func fetchArchive(ctx context.Context, origin *Origin) (billy.Filesystem, CommitInfoProvider, error) {
+
+	fmt.Printf("\nExtracting archive '%s' ...\n", origin.URL)
+
+	data, name, err := readSource(ctx, origin)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	filesystem := memfs.New()
+	err = extractArchive(name, data, filesystem)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, fmt.Sprintf("Error extracting archive %s", origin.URL))
+	}
+	return filesystem, nil, nil
+}
+
+// fetchHTTP downloads the document given as src into a virtual filesystem. The document
+// is stored with the last element of the URL path as name
+func fetchHTTP(ctx context.Context, origin *Origin) (billy.Filesystem, CommitInfoProvider, error) {
+
+	fmt.Printf("\nDownloading '%s' ...\n", origin.URL)
+
+	data, name, err := readSource(ctx, origin)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	name = path.Base(name)
+	if name == "/" || name == "." {
+		return nil, nil, fmt.Errorf("can't determine a file name for %s", origin.URL)
+	}
+
+	filesystem := memfs.New()
+	err = util.WriteFile(filesystem, name, data, standardFilemode)
+	if err != nil {
+		return nil, nil, err
+	}
+	return filesystem, nil, nil
+}
+
+// readSource returns the content of the src of the origin, which is either a HTTP URL or a local
+// file, and its path. HTTP requests use the username and password of the origin, if set
+func readSource(ctx context.Context, origin *Origin) (data []byte, name string, err error) {
+
+	u, err := url.Parse(origin.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		data, err = ioutil.ReadFile(origin.URL)
+		if err != nil {
+			return nil, "", errors.Wrap(err, fmt.Sprintf("Error reading %s", origin.URL))
+		}
+		return data, filepath.ToSlash(origin.URL), nil
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, origin.URL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	username := os.Getenv(origin.EnvUsername)
+	password := os.Getenv(origin.EnvPassword)
+	if username != "" && password != "" {
+		request.SetBasicAuth(username, password)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, "", errors.Wrap(err, fmt.Sprintf("Error downloading %s", origin.URL))
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("downloading %s returned HTTP %d", origin.URL, response.StatusCode)
+	}
+
+	data, err = ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, "", errors.Wrap(err, fmt.Sprintf("Error downloading %s", origin.URL))
+	}
+	return data, u.Path, nil
+}
+
+// extractArchive extracts the archive into the filesystem. The format is detected by the
+// extension of name, supported are .zip, .tar, .tar.gz and .tgz
+func extractArchive(name string, data []byte, filesystem billy.Filesystem) error {
+
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		// Insecure paths are kept within the archive by writeArchiveFile
+		archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil && err != zip.ErrInsecurePath {
+			return err
+		}
+		for _, file := range archive.File {
+			if file.FileInfo().IsDir() {
+				continue
+			}
+			content, err := file.Open()
+			if err != nil {
+				return err
+			}
+			err = writeArchiveFile(filesystem, file.Name, content)
+			content.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz"):
+		uncompressed, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		defer uncompressed.Close()
+		return extractTar(uncompressed, filesystem)
+
+	case strings.HasSuffix(name, ".tar"):
+		return extractTar(bytes.NewReader(data), filesystem)
+
+	default:
+		return fmt.Errorf("unknown archive format of %s, use .zip, .tar, .tar.gz or .tgz", name)
+	}
+}
+
+// extractTar extracts all regular files of the tar stream into the filesystem
+func extractTar(reader io.Reader, filesystem billy.Filesystem) error {
+	archive := tar.NewReader(reader)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil && err != tar.ErrInsecurePath {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		err = writeArchiveFile(filesystem, header.Name, archive)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// writeArchiveFile writes a file of an archive to the filesystem. Paths leaving the
+// root of the archive are kept within it
+func writeArchiveFile(filesystem billy.Filesystem, name string, content io.Reader) error {
+	name = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+	if name == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadAll(content)
+	if err != nil {
+		return err
+	}
+	return util.WriteFile(filesystem, name, data, standardFilemode)
+}
@@ -0,0 +1,211 @@
+package compose
+
+// run: go test ./pkg/compose -run TestFetch
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Flaque/filet"
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// testArchiveFiles is the content of the test archives
+var testArchiveFiles = map[string]string{
+	"docs/README.md":     "# Readme",
+	"docs/sub/guide.md":  "# Guide",
+	"../outside/evil.md": "# Evil",
+}
+
+func createZip(t *testing.T) []byte {
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	for name, content := range testArchiveFiles {
+		file, err := archive.Create(name)
+		assert.NoError(t, err)
+		_, err = file.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, archive.Close())
+	return buffer.Bytes()
+}
+
+func createTarGz(t *testing.T) []byte {
+	var buffer bytes.Buffer
+	compressed := gzip.NewWriter(&buffer)
+	archive := tar.NewWriter(compressed)
+	for name, content := range testArchiveFiles {
+		err := archive.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		assert.NoError(t, err)
+		_, err = archive.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, archive.Close())
+	assert.NoError(t, compressed.Close())
+	return buffer.Bytes()
+}
+
+func readTestFile(t *testing.T, filesystem billy.Filesystem, name string) string {
+	content, err := util.ReadFile(filesystem, name)
+	assert.NoError(t, err)
+	return string(content)
+}
+
+func TestFetchLocal(t *testing.T) {
+
+	t.Run("Plain directory", func(t *testing.T) {
+		// The local temp dir is within the Monako repository, use the temp dir of the system
+		dir := filet.TmpDir(t, "")
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("# Local"), standardFilemode))
+		config, _ := getTestConfig(t, Origin{Type: LocalSource, URL: dir, TargetDir: "docs/local", FileWhitelist: []string{".md"}})
+		origin := &config.Origins[0]
+
+		filesystem, err := origin.Fetch(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "# Local", readTestFile(t, filesystem, "README.md"))
+		assert.Nil(t, origin.commits, "No commit info outside of Git repositories")
+
+		err = origin.ComposeDir(context.Background(), filesystem)
+		assert.NoError(t, err)
+		assert.FileExists(t, filepath.Join(config.ContentWorkingDir, "docs/local/README.md"))
+	})
+
+	t.Run("Directory in Git repository", func(t *testing.T) {
+		testRepo := os.Getenv("MONAKO_TEST_REPO")
+		if testRepo == "" {
+			t.Skip("MONAKO_TEST_REPO is not set")
+		}
+
+		config, _ := getTestConfig(t, Origin{Type: LocalSource, URL: filepath.Join(testRepo, "subfolder"), TargetDir: "docs"})
+		origin := &config.Origins[0]
+
+		_, err := origin.Fetch(context.Background())
+		assert.NoError(t, err)
+		assert.NotNil(t, origin.commits)
+
+		commit, err := origin.commits.CommitInfo(context.Background(), "subfolderprofile.png")
+		assert.NoError(t, err)
+		assert.Contains(t, commit.Author.Email, "@")
+	})
+
+	t.Run("Missing directory", func(t *testing.T) {
+		config, _ := getTestConfig(t, Origin{Type: LocalSource, URL: "missing path", TargetDir: "docs"})
+		_, err := config.Origins[0].Fetch(context.Background())
+		assert.Error(t, err)
+	})
+}
+
+func TestFetchArchive(t *testing.T) {
+
+	dir := GetLocalTempDir(t)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "docs.zip"), createZip(t), standardFilemode))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/docs.tar.gz":
+			w.Write(createTarGz(t))
+		case "/private/README.md":
+			if username, password, _ := r.BasicAuth(); username != "user" || password != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte("# Downloaded"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	for _, src := range []string{filepath.Join(dir, "docs.zip"), server.URL + "/docs.tar.gz"} {
+		t.Run(src, func(t *testing.T) {
+			config, _ := getTestConfig(t, Origin{Type: ArchiveSource, URL: src, SourceDir: "docs", TargetDir: "docs"})
+
+			filesystem, err := config.Origins[0].Fetch(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, "# Readme", readTestFile(t, filesystem, "docs/README.md"))
+			assert.Equal(t, "# Guide", readTestFile(t, filesystem, "docs/sub/guide.md"))
+			assert.Equal(t, "# Evil", readTestFile(t, filesystem, "outside/evil.md"), "Paths are kept within the archive")
+		})
+	}
+
+	t.Run("Unknown archive format", func(t *testing.T) {
+		assert.Error(t, extractArchive("docs.rar", nil, memfs.New()))
+	})
+
+	t.Run("Single document via HTTP", func(t *testing.T) {
+		os.Setenv("MONAKO_TEST_HTTP_USER", "user")
+		os.Setenv("MONAKO_TEST_HTTP_PASSWORD", "secret")
+		defer os.Unsetenv("MONAKO_TEST_HTTP_USER")
+		defer os.Unsetenv("MONAKO_TEST_HTTP_PASSWORD")
+
+		config, _ := getTestConfig(t, Origin{
+			Type:        HTTPSource,
+			URL:         server.URL + "/private/README.md",
+			TargetDir:   "docs",
+			EnvUsername: "MONAKO_TEST_HTTP_USER",
+			EnvPassword: "MONAKO_TEST_HTTP_PASSWORD",
+		})
+
+		filesystem, err := config.Origins[0].Fetch(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "# Downloaded", readTestFile(t, filesystem, "README.md"))
+
+		config.Origins[0].EnvPassword = ""
+		_, err = config.Origins[0].Fetch(context.Background())
+		assert.Error(t, err)
+	})
+}
+
+func TestRegisterFetcher(t *testing.T) {
+
+	RegisterFetcher("internal", FetcherFunc(func(ctx context.Context, origin *Origin) (billy.Filesystem, CommitInfoProvider, error) {
+		filesystem := memfs.New()
+		err := util.WriteFile(filesystem, "internal.md", []byte("# "+origin.URL), standardFilemode)
+		return filesystem, nil, err
+	}))
+	defer func() {
+		fetchersMutex.Lock()
+		delete(fetchers, "internal")
+		fetchersMutex.Unlock()
+	}()
+
+	configFile := writeTestConfig(t, `
+origins:
+  - type: internal
+    src: wiki
+    targetdir: docs/internal
+`)
+	config, err := LoadConfig(configFile, GetLocalTempDir(t))
+	assert.NoError(t, err)
+
+	filesystem, err := config.Origins[0].Fetch(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "# wiki", readTestFile(t, filesystem, "internal.md"))
+
+	t.Run("Unknown type", func(t *testing.T) {
+		configFile := writeTestConfig(t, `
+origins:
+  - type: svn
+    src: https://svn.example.com/docs
+    targetdir: docs
+`)
+		_, err := LoadConfig(configFile, "")
+		assert.Error(t, err)
+		errs := err.(ConfigErrors)
+		assert.Len(t, errs, 1)
+		assert.Equal(t, "origins[0].type", errs[0].Field)
+		assert.Contains(t, errs[0].Message, "archive, git, http")
+	})
+}
@@ -3,6 +3,9 @@ package compose
 // run: MONAKO_HUGE_REPOS_TEST=true go test -v ./pkg/compose/ -run TestHugeRepositories
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"github.com/go-git/go-billy/v5"
 	"github.com/go-git/go-git/v5"
@@ -10,12 +13,10 @@ import (
 	"io/ioutil"
 	"net/url"
 	"os"
-	"path"
 	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/gohugoio/hugo/parser/pageparser"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
@@ -30,13 +31,27 @@ type OriginFile struct {
 
 	// Commit is the commit info about this file
 	Commit *OriginFileCommit
+	// FirstCommit is the commit adding this file
+	FirstCommit *OriginFileCommit
+	// History contains the last commits of this file, if the history is enabled
+	History []OriginFileCommit
+	// Contributors are the authors of all commits of this file, if the history is enabled
+	Contributors []OriginFileContributor
+	// Owners own this file according to the CODEOWNERS of the repository or the owner of the origin
+	Owners []string
 	// RemotePath is the path in the origin repository
 	RemotePath string
 	// LocalPath is the absolute path on the local disk
 	LocalPath string
+	// ContentHash is the SHA-256 hash of the composed file
+	ContentHash string
 
 	// parentOrigin of this file
 	parentOrigin *Origin
+	// filesystem the file is composed from
+	filesystem billy.Filesystem
+	// unplanned is set if planning skipped a processor or lookup the content of the file depends on
+	unplanned bool
 }
 
 // OriginFileCommit represents a commit
@@ -44,6 +59,8 @@ type OriginFileCommit struct {
 	Hash   string
 	Author OriginFileCommitter
 	Date   time.Time
+	// Message is the first line of the commit message, only set for the history
+	Message string
 }
 
 // OriginFileCommitter represents the committer of a commit
@@ -52,7 +69,9 @@ type OriginFileCommitter struct {
 	Email string
 }
 
-func (file *OriginFile) composeFile(filesystem billy.Filesystem) error {
+func (file *OriginFile) composeFile(ctx context.Context, filesystem billy.Filesystem) error {
+
+	file.filesystem = filesystem
 
 	err := createParentDir(file.LocalPath)
 	if err != nil {
@@ -62,7 +81,7 @@ func (file *OriginFile) composeFile(filesystem billy.Filesystem) error {
 
 	switch contentFormat {
 	case Asciidoc, Markdown:
-		err := file.copyMarkupFile(filesystem)
+		err := file.copyMarkupFile(ctx)
 		if err != nil {
 			return errors.Wrap(err, fmt.Sprintf("Error copying markup file"))
 		}
@@ -101,25 +120,41 @@ func createParentDir(localPath string) error {
 
 func (file *OriginFile) copyRegularFile(filesystem billy.Filesystem) error {
 
-	f, err := filesystem.Open(file.RemotePath)
+	if file.parentOrigin != nil && file.parentOrigin.config.incremental() {
+		contentHash, err := hashRemoteFile(filesystem, file.RemotePath)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Error reading regular remote file %s", file.RemotePath))
+		}
+		if hasContent(file.LocalPath, contentHash) {
+			// Keep the modification time of unchanged files
+			file.ContentHash = contentHash
+			return nil
+		}
+	}
+
+	f, err := openRemoteFile(filesystem, file.RemotePath)
 
 	if err != nil {
 		return errors.Wrap(err, fmt.Sprintf("Error opening regular remote file for copying %s", file.RemotePath))
 	}
+	defer f.Close()
 	t, err := os.Create(file.LocalPath)
 	if err != nil {
 		return errors.Wrap(err, fmt.Sprintf("Error creating regular local file %s", file.LocalPath))
 	}
+	defer t.Close()
 
-	if _, err = io.Copy(t, f); err != nil {
+	hash := sha256.New()
+	if _, err = io.Copy(io.MultiWriter(t, hash), f); err != nil {
 		return errors.Wrap(err, fmt.Sprintf("Error copying regular remote file to local file %s -> %s", file.RemotePath, file.LocalPath))
 	}
+	file.ContentHash = hex.EncodeToString(hash.Sum(nil))
 	return nil
 }
 
 // getCommitInfo returns the Commit Info for a given file of the repository
 // identified by it's filename
-func getCommitInfo(remotePath string, repo *git.Repository) (*OriginFileCommit, error) {
+func getCommitInfo(ctx context.Context, remotePath string, repo *git.Repository) (*OriginFileCommit, error) {
 
 	log.Debugf("Getting commit info for %s", remotePath)
 
@@ -127,6 +162,10 @@ func getCommitInfo(remotePath string, repo *git.Repository) (*OriginFileCommit,
 		return nil, fmt.Errorf("Repository is nil")
 	}
 
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	// Problem seems to be the longer the file hasn't been in the log, the longer it takes to retrieve it
 	cIter, err := repo.Log(&git.LogOptions{
 		FileName: &remotePath,
@@ -158,31 +197,59 @@ func getCommitInfo(remotePath string, repo *git.Repository) (*OriginFileCommit,
 	}, nil
 }
 
-func (file *OriginFile) copyMarkupFile(filesystem billy.Filesystem) error {
+// processedContent returns the content of the markup file transformed by the processors of its origin
+func (file *OriginFile) processedContent(ctx context.Context) ([]byte, error) {
 
-	bf, err := filesystem.Open(file.RemotePath)
+	content, err := file.ReadRemoteFile(file.RemotePath)
 	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("Error opening markup file %s", file.RemotePath))
+		return nil, errors.Wrap(err, fmt.Sprintf("Error reading markup file %s", file.RemotePath))
 	}
 
-	c, err := ioutil.ReadAll(bf)
+	content, err = process(ctx, file.parentOrigin.pipeline, file, content)
 	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("Error reading markup file %s", file.RemotePath))
+		return nil, errors.Wrap(err, fmt.Sprintf("Error processing %s -> %s", file.RemotePath, file.LocalPath))
 	}
-	content := string(c)
+	return content, nil
+}
+
+func (file *OriginFile) copyMarkupFile(ctx context.Context) error {
 
-	content, err = file.ExpandFrontmatter(string(content))
+	content, err := file.processedContent(ctx)
 	if err != nil {
-		return errors.Wrap(err, fmt.Sprintf("Error expanding frontmatter for %s -> %s", file.RemotePath, file.LocalPath))
+		return err
+	}
+
+	hash := sha256.Sum256(content)
+	file.ContentHash = hex.EncodeToString(hash[:])
+
+	if file.parentOrigin.config.incremental() && hasContent(file.LocalPath, file.ContentHash) {
+		// Keep the modification time of unchanged files
+		return nil
 	}
 
-	err = ioutil.WriteFile(file.LocalPath, []byte(content), standardFilemode)
+	err = ioutil.WriteFile(file.LocalPath, content, standardFilemode)
 	if err != nil {
 		return errors.Wrap(err, fmt.Sprintf("Error writing remote markup file to local file %s -> %s", file.RemotePath, file.LocalPath))
 	}
 	return nil
 }
 
+// ReadRemoteFile returns the content of a file of the origin this file is composed from.
+// The remotePath is relative to the root of the origin
+func (file *OriginFile) ReadRemoteFile(remotePath string) ([]byte, error) {
+	if file.filesystem == nil {
+		return nil, fmt.Errorf("%s is not being composed", file.RemotePath)
+	}
+
+	f, err := openRemoteFile(file.filesystem, remotePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ioutil.ReadAll(f)
+}
+
 // getLocalFilePath returns the desired local file path for a remote file in the local filesystem.
 // It is based on the local absolute composeDir, the remoteDocDir to strip it's path from the local file,
 // the target dir to generate the local path and the file name itself
@@ -192,123 +259,121 @@ func getLocalFilePath(composeDir, remoteDocDir string, targetDir string, remoteF
 	return filepath.Join(composeDir, targetDir, relativeFilePath)
 }
 
-// ExpandFrontmatter expands the existing frontmatter with the parameters given
+// ExpandFrontmatter merges the Git information, the defaults and rules of the front matter settings and the
+// owners of the file into the front matter of the content and extracts the title if enabled. Fields set by the
+// document are kept unless the precedence in the config is monako. The content is returned unchanged if
+// nothing is added
 func (file *OriginFile) ExpandFrontmatter(content string) (expandedFrontmatter string, err error) {
 
-	if file.Commit == nil {
+	var fields yaml.MapSlice
+	if file.Commit != nil {
+		fields = file.gitFrontmatterFields()
+	} else {
 		log.Debug("Git Info is not set, returning without adding it")
+	}
+	fields = append(append(fields, file.ruleFields()...), file.ownerFields()...)
+
+	settings := file.parentOrigin.frontmatterConfig()
+	if len(fields) == 0 && !settings.ExtractTitle {
 		return content, nil
 	}
 
-	oldFrontmatter, body, err := splitFrontmatterAndBody(content)
+	matter, body, err := parseFrontmatter(content)
 	if err != nil {
-		return "", errors.Wrap(err, fmt.Sprintf("Error expanding front matter"))
-	}
-
-	return fmt.Sprintf(`---
-%s
-
-MonakoGitRemote: %s
-MonakoGitRemotePath: %s
-MonakoGitURL: %s
-MonakoGitLastCommitHash: %s
-MonakoGitURLCommit: %s
-lastMod: %s
-MonakoGitLastCommitAuthor: %s
-MonakoGitLastCommitAuthorEmail: %s
----
-
-%s`,
-			oldFrontmatter,
-			file.parentOrigin.URL,
-			file.RemotePath,
-			getWebLinkForFileInGit(
-				file.parentOrigin.URL,
-				file.parentOrigin.Branch,
-				file.RemotePath,
-			),
-			file.Commit.Hash,
-			getWebLinkForGitCommit(
-				file.parentOrigin.URL,
-				file.Commit.Hash,
-			),
-			// Use lastMod because other variables won't be parsed as date by Hugo
-			// Resulting in no date format functions on the file
-			file.Commit.Date.Format(time.RFC3339),
-			file.Commit.Author.Name,
-			file.Commit.Author.Email,
-			body,
-		),
-		nil
-
-}
+		return "", errors.Wrap(err, fmt.Sprintf("Error expanding front matter of %s", file.RemotePath))
+	}
 
-func splitFrontmatterAndBody(content string) (frontmatter string, body string, err error) {
-	contentFrontmatter, err := pageparser.ParseFrontMatterAndContent(strings.NewReader(content))
-	if err != nil {
-		return "", "", errors.Wrap(err, fmt.Sprintf("While splitting frontmatter for content: %s", content))
+	for _, field := range fields {
+		matter.set(fmt.Sprint(field.Key), field.Value, settings.Precedence)
 	}
 
-	// No frontmatter found, return old content
-	if contentFrontmatter.Content == nil {
-		return "", content, nil
+	// Titles set by the document or by rules are kept
+	if settings.ExtractTitle && !matter.has("title") {
+		if title, stripped := extractTitle(body, file.GetFormat()); title != "" {
+			matter.set("title", title, PrecedenceDocument)
+			if settings.StripTitle {
+				body = stripped
+			}
+			fields = append(fields, yaml.MapItem{Key: "title", Value: title})
+		}
+	}
+	if len(fields) == 0 {
+		return content, nil
 	}
 
-	contentMarshaled, err := yaml.Marshal(contentFrontmatter.FrontMatter)
+	expanded, err := matter.render(body, settings.KeepFormat)
 	if err != nil {
-		return "", "", errors.Wrap(err, fmt.Sprintf("Error while marshalling frontmatter to YAML"))
+		return "", errors.Wrap(err, fmt.Sprintf("Error writing front matter of %s", file.RemotePath))
 	}
-
-	return string(contentMarshaled), string(contentFrontmatter.Content), nil
+	return expanded, nil
 }
 
-func getWebLinkForFileInGit(gitURL string, branch string, remotePath string) string {
-
-	// URLs for checkout have .git suffix
-	gitURL = strings.TrimSuffix(gitURL, ".git")
-	u, err := url.Parse(gitURL)
+// gitFrontmatterFields returns the fields Monako adds to the front matter of the file
+func (file *OriginFile) gitFrontmatterFields() yaml.MapSlice {
+	hosts := file.parentOrigin.gitProviderHosts()
 
-	if err != nil {
-		return ""
+	editURL := ""
+	if !file.parentOrigin.DisableEditLinks {
+		editURL = getEditLinkForFileInGit(file.parentOrigin.URL, file.parentOrigin.Branch, file.RemotePath, hosts)
 	}
 
-	if !strings.Contains(u.Scheme, "http") {
-		return ""
+	fields := yaml.MapSlice{
+		{Key: "MonakoGitRemote", Value: file.parentOrigin.URL},
+		{Key: "MonakoGitRemotePath", Value: file.RemotePath},
+		{Key: "MonakoGitURL", Value: getWebLinkForFileInGit(file.parentOrigin.URL, file.parentOrigin.Branch, file.RemotePath, hosts)},
+		{Key: "MonakoGitEditURL", Value: editURL},
+		{Key: "MonakoGitLastCommitHash", Value: file.Commit.Hash},
+		{Key: "MonakoGitURLCommit", Value: getWebLinkForGitCommit(file.parentOrigin.URL, file.Commit.Hash, hosts)},
+		// Use lastMod because other variables won't be parsed as date by Hugo
+		// Resulting in no date format functions on the file
+		{Key: "lastMod", Value: file.Commit.Date},
+		{Key: "MonakoGitLastCommitAuthor", Value: file.Commit.Author.Name},
+		{Key: "MonakoGitLastCommitAuthorEmail", Value: file.Commit.Author.Email},
 	}
 
-	// This works for Github and Gitlab
-	middlePath := "blob"
-
-	// Bitbucket does it differently
-	if strings.Contains(u.Host, "bitbucket") {
-		middlePath = "src"
+	if file.FirstCommit != nil {
+		fields = append(fields,
+			yaml.MapItem{Key: "date", Value: file.FirstCommit.Date},
+			yaml.MapItem{Key: "MonakoGitFirstCommitAuthor", Value: file.FirstCommit.Author.Name},
+			yaml.MapItem{Key: "MonakoGitFirstCommitAuthorEmail", Value: file.FirstCommit.Author.Email},
+		)
 	}
 
-	u.Path = path.Join(u.Path, middlePath, branch, remotePath)
-	return u.String()
-}
-
-func getWebLinkForGitCommit(gitURL string, commitID string) string {
-	// URLs for checkout have .git suffix
-	gitURL = strings.TrimSuffix(gitURL, ".git")
-	u, err := url.Parse(gitURL)
-
-	if err != nil {
-		return ""
+	if file.isStale(time.Now()) {
+		fields = append(fields, yaml.MapItem{Key: "MonakoGitStale", Value: true})
 	}
 
-	if !strings.Contains(u.Scheme, "http") {
-		return ""
+	history, contributors := file.historyFields()
+	if len(history) > 0 {
+		fields = append(fields, yaml.MapItem{Key: "MonakoGitHistory", Value: history})
+	}
+	if len(contributors) > 0 {
+		fields = append(fields, yaml.MapItem{Key: "MonakoGitContributors", Value: contributors})
 	}
+	return fields
+}
 
-	// This works for Github and Gitlab
-	middlePath := "commit"
+// getWebLinkForFileInGit returns the link to the file in the web interface of the Git hosting service.
+// The service is determined by the host of gitURL, hosts maps further hosts to providers
+func getWebLinkForFileInGit(gitURL string, branch string, remotePath string, hosts map[string]string) string {
+	return webLink(gitURL, hosts, func(provider GitProvider, repository *url.URL) string {
+		return provider.FileURL(repository, branch, remotePath)
+	})
+}
 
-	// Bitbucket does it differently
-	if strings.Contains(u.Host, "bitbucket") {
-		middlePath = "commits"
+// getEditLinkForFileInGit returns the link for editing the file in the web interface of the Git hosting service
+func getEditLinkForFileInGit(gitURL string, branch string, remotePath string, hosts map[string]string) string {
+	if branch == "" {
+		return ""
 	}
+	return webLink(gitURL, hosts, func(provider GitProvider, repository *url.URL) string {
+		return provider.EditURL(repository, branch, remotePath)
+	})
+}
 
-	u.Path = path.Join(u.Path, middlePath, commitID)
-	return u.String()
+// getWebLinkForGitCommit returns the link to the commit in the web interface of the Git hosting service
+func getWebLinkForGitCommit(gitURL string, commitID string, hosts map[string]string) string {
+	return webLink(gitURL, hosts, func(provider GitProvider, repository *url.URL) string {
+		return provider.CommitURL(repository, commitID)
+	})
 }
@@ -0,0 +1,419 @@
+package compose
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/gohugoio/hugo/parser/metadecoders"
+	"github.com/gohugoio/hugo/parser/pageparser"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Precedences for fields set by the document and by Monako
+const (
+	// PrecedenceDocument keeps the values set in the front matter of the document. This is the default
+	PrecedenceDocument = "document"
+	// PrecedenceMonako replaces the values set in the front matter of the document
+	PrecedenceMonako = "monako"
+)
+
+// precedences are the valid values of the precedence of front matter fields
+var precedences = []string{PrecedenceDocument, PrecedenceMonako}
+
+// isPrecedence returns true if precedence is a valid precedence of front matter fields
+func isPrecedence(precedence string) bool {
+	for _, valid := range precedences {
+		if precedence == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// FrontmatterConfig configures how Monako adds its fields to the front matter of documents
+type FrontmatterConfig struct {
+	// Precedence decides whose value is kept for fields set by the document and by Monako: document or monako
+	Precedence string `yaml:"precedence,omitempty"`
+	// KeepFormat writes the front matter in the format of the document instead of converting it to YAML
+	KeepFormat bool `yaml:"keepFormat,omitempty"`
+	// Defaults are added to the front matter of all documents
+	Defaults map[string]interface{} `yaml:"defaults,omitempty"`
+	// Rules add fields to the front matter of the documents matching their pattern
+	Rules []FrontmatterRule `yaml:"rules,omitempty"`
+	// ExtractTitle uses the first heading as title of documents without title
+	ExtractTitle bool `yaml:"extractTitle,omitempty"`
+	// StripTitle removes the heading used as title from the document
+	StripTitle bool `yaml:"stripTitle,omitempty"`
+}
+
+// FrontmatterRule adds fields to the front matter of the documents matching a pattern
+type FrontmatterRule struct {
+	// Match is the pattern for the paths of documents relative to the docdir, like internal/**.
+	// Elements are matched like path.Match, ** matches any number of folders
+	Match string `yaml:"match"`
+	// Set contains the fields added to the matching documents
+	Set map[string]interface{} `yaml:"set,omitempty"`
+	// WeightFromPrefix sets the weight to the number the name of the document starts with, like 2 for 02-setup.md
+	WeightFromPrefix bool `yaml:"weightFromPrefix,omitempty"`
+}
+
+// weightPrefix matches names starting with a number, like 02-setup or 10_install
+var weightPrefix = regexp.MustCompile(`^(\d+)[-_. ]`)
+
+// frontmatter is the parsed front matter of a document, preserving the order of its fields
+type frontmatter struct {
+	// format is the format of the front matter in the document, empty if it had none
+	format metadecoders.Format
+	fields yaml.MapSlice
+}
+
+// parseFrontmatter splits the content of a document into its parsed front matter and its body
+func parseFrontmatter(content string) (*frontmatter, string, error) {
+	result, err := pageparser.Parse(strings.NewReader(content), pageparser.Config{})
+	if err != nil {
+		return nil, "", err
+	}
+
+	var source []byte
+	matter := &frontmatter{}
+	body := content
+	result.Iterator().PeekWalk(func(item pageparser.Item) bool {
+		if source != nil {
+			// The rest is content
+			body = string(result.Input()[item.Pos:])
+			return false
+		} else if item.IsFrontMatter() {
+			matter.format = pageparser.FormatFromFrontMatterType(item.Type)
+			source = item.Val
+		}
+		return true
+	})
+	if source == nil {
+		return matter, content, nil
+	}
+
+	matter.fields, err = decodeFrontmatterFields(source, matter.format)
+	if err != nil {
+		return nil, "", errors.Wrap(err, fmt.Sprintf("Error parsing %s front matter", matter.format))
+	}
+	return matter, body, nil
+}
+
+// decodeFrontmatterFields returns the fields of the front matter in the order of the source
+func decodeFrontmatterFields(source []byte, format metadecoders.Format) (yaml.MapSlice, error) {
+	var fields yaml.MapSlice
+
+	switch format {
+	case metadecoders.YAML:
+		err := yaml.Unmarshal(source, &fields)
+		return fields, err
+
+	case metadecoders.TOML:
+		values := map[string]interface{}{}
+		metadata, err := toml.Decode(string(source), &values)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range metadata.Keys() {
+			if len(key) == 1 {
+				fields = append(fields, yaml.MapItem{Key: key[0], Value: values[key[0]]})
+			}
+		}
+		return fields, nil
+
+	case metadecoders.JSON:
+		decoder := json.NewDecoder(bytes.NewReader(source))
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			var value interface{}
+			if err = decoder.Decode(&value); err != nil {
+				return nil, err
+			}
+			fields = append(fields, yaml.MapItem{Key: key, Value: value})
+		}
+		return fields, nil
+	}
+
+	// Formats without order, like Org mode, are sorted by key
+	values, err := metadecoders.Default.UnmarshalToMap(source, format)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range values {
+		fields = append(fields, yaml.MapItem{Key: key, Value: value})
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Key.(string) < fields[j].Key.(string)
+	})
+	return fields, nil
+}
+
+// has returns true if the front matter contains the key
+func (matter *frontmatter) has(key string) bool {
+	return matter.index(key) >= 0
+}
+
+// index returns the index of the field with the key, -1 if it's not set. Hugo ignores the case of keys
+func (matter *frontmatter) index(key string) int {
+	for i, field := range matter.fields {
+		if strings.EqualFold(fmt.Sprint(field.Key), key) {
+			return i
+		}
+	}
+	return -1
+}
+
+// set adds the field to the front matter. Fields set by the document are only replaced
+// if precedence is monako. Empty values are not added
+func (matter *frontmatter) set(key string, value interface{}, precedence string) {
+	if value == nil || value == "" {
+		return
+	}
+	if i := matter.index(key); i < 0 {
+		matter.fields = append(matter.fields, yaml.MapItem{Key: key, Value: value})
+	} else if precedence == PrecedenceMonako {
+		matter.fields[i].Value = value
+	}
+}
+
+// render returns the front matter followed by the body. The front matter is written as YAML
+// unless keepFormat is set and the document used another format
+func (matter *frontmatter) render(body string, keepFormat bool) (string, error) {
+	format := metadecoders.YAML
+	if keepFormat && matter.format != "" {
+		format = matter.format
+	}
+
+	switch format {
+	case metadecoders.TOML:
+		var buf bytes.Buffer
+		encoder := toml.NewEncoder(&buf)
+		// TOML requires the keys of the document before its tables
+		for _, tables := range []bool{false, true} {
+			for _, field := range matter.fields {
+				value := plainValue(field.Value)
+				if isTOMLTable(value) != tables {
+					continue
+				}
+				if err := encoder.Encode(map[string]interface{}{fmt.Sprint(field.Key): value}); err != nil {
+					return "", err
+				}
+			}
+		}
+		return fmt.Sprintf("+++\n%s+++\n%s", buf.String(), body), nil
+
+	case metadecoders.JSON:
+		content, err := json.MarshalIndent(orderedJSON(matter.fields), "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s\n%s", content, body), nil
+	}
+
+	content, err := yaml.Marshal(matter.fields)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("---\n%s---\n%s", content, body), nil
+}
+
+// plainValue converts the ordered maps of a value to plain maps
+func plainValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case yaml.MapSlice:
+		plain := map[string]interface{}{}
+		for _, item := range v {
+			plain[fmt.Sprint(item.Key)] = plainValue(item.Value)
+		}
+		return plain
+	case map[interface{}]interface{}:
+		plain := map[string]interface{}{}
+		for key, item := range v {
+			plain[fmt.Sprint(key)] = plainValue(item)
+		}
+		return plain
+	case []yaml.MapSlice:
+		plain := make([]map[string]interface{}, len(v))
+		for i, item := range v {
+			plain[i] = plainValue(item).(map[string]interface{})
+		}
+		return plain
+	case []interface{}:
+		plain := make([]interface{}, len(v))
+		for i, item := range v {
+			plain[i] = plainValue(item)
+		}
+		return plain
+	}
+	return value
+}
+
+// isTOMLTable returns true if the value is written as table or array of tables
+func isTOMLTable(value interface{}) bool {
+	switch v := value.(type) {
+	case map[string]interface{}, []map[string]interface{}:
+		return true
+	case []interface{}:
+		if len(v) > 0 {
+			_, isMap := v[0].(map[string]interface{})
+			return isMap
+		}
+	}
+	return false
+}
+
+// orderedJSON marshals ordered maps to JSON objects keeping the order of their keys
+type orderedJSON yaml.MapSlice
+
+// MarshalJSON writes the fields as JSON object
+func (fields orderedJSON) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for i, field := range fields {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		key, err := json.Marshal(fmt.Sprint(field.Key))
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(jsonValue(field.Value))
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteString(":")
+		buf.Write(value)
+	}
+	buf.WriteString("}")
+	return buf.Bytes(), nil
+}
+
+// jsonValue converts the ordered maps of a value for marshalling to JSON
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case yaml.MapSlice:
+		return orderedJSON(v)
+	case []yaml.MapSlice:
+		converted := make([]interface{}, len(v))
+		for i, item := range v {
+			converted[i] = orderedJSON(item)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, item := range v {
+			converted[i] = jsonValue(item)
+		}
+		return converted
+	case map[interface{}]interface{}:
+		return plainValue(v)
+	}
+	return value
+}
+
+// frontmatterConfigs returns the front matter settings of the config, of the docdir and of the origin, in this order
+func (origin *Origin) frontmatterConfigs() []FrontmatterConfig {
+	var configs []FrontmatterConfig
+	if origin == nil {
+		return configs
+	}
+	if origin.config != nil {
+		configs = append(configs, origin.config.Frontmatter)
+	}
+	if origin.repoFiles.frontmatter != nil {
+		configs = append(configs, *origin.repoFiles.frontmatter)
+	}
+	if origin.Frontmatter != nil {
+		configs = append(configs, *origin.Frontmatter)
+	}
+	return configs
+}
+
+// frontmatterConfig returns the front matter settings for the documents of the origin.
+// The precedence of the origin replaces the one of the config
+func (origin *Origin) frontmatterConfig() FrontmatterConfig {
+	var settings FrontmatterConfig
+	for _, config := range origin.frontmatterConfigs() {
+		if config.Precedence != "" {
+			settings.Precedence = config.Precedence
+		}
+		settings.KeepFormat = settings.KeepFormat || config.KeepFormat
+		settings.ExtractTitle = settings.ExtractTitle || config.ExtractTitle
+		settings.StripTitle = settings.StripTitle || config.StripTitle
+	}
+	return settings
+}
+
+// documentPath returns the path of the file relative to the docdir of its origin
+func (file *OriginFile) documentPath() string {
+	remotePath := path.Clean(filepath.ToSlash(file.RemotePath))
+	sourceDir := path.Clean(filepath.ToSlash(file.parentOrigin.SourceDir))
+	if sourceDir == "." {
+		return remotePath
+	}
+	return strings.TrimPrefix(remotePath, sourceDir+"/")
+}
+
+// ruleFields returns the fields the defaults and rules of the front matter settings add to the file.
+// Rules replace defaults, the settings of the origin replace the ones of the config
+func (file *OriginFile) ruleFields() yaml.MapSlice {
+	documentPath := file.documentPath()
+	fields := &frontmatter{}
+	setAll := func(values map[string]interface{}) {
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fields.set(key, values[key], PrecedenceMonako)
+		}
+	}
+
+	for _, settings := range file.parentOrigin.frontmatterConfigs() {
+		setAll(settings.Defaults)
+		for _, rule := range settings.Rules {
+			if !matchPath(rule.Match, documentPath) {
+				continue
+			}
+			setAll(rule.Set)
+			if weight, found := weightFromPrefix(documentPath); rule.WeightFromPrefix && found {
+				fields.set("weight", weight, PrecedenceMonako)
+			}
+		}
+	}
+	return fields.fields
+}
+
+// weightFromPrefix returns the number the name of the document starts with. Index documents
+// of a folder, like README.md, use the name of the folder
+func weightFromPrefix(documentPath string) (int, bool) {
+	name := strings.TrimSuffix(path.Base(documentPath), path.Ext(documentPath))
+	switch strings.ToLower(name) {
+	case "readme", "index", "_index":
+		name = path.Base(path.Dir(documentPath))
+	}
+
+	match := weightPrefix.FindStringSubmatch(name)
+	if match == nil {
+		return 0, false
+	}
+	weight, err := strconv.Atoi(match[1])
+	return weight, err == nil
+}
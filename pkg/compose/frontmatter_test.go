@@ -0,0 +1,222 @@
+package compose
+
+// run: go test ./pkg/compose -run TestFrontmatter
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getFrontmatterTestFile(settings FrontmatterConfig) *OriginFile {
+	return &OriginFile{
+		RemotePath: "docs/README.md",
+		parentOrigin: &Origin{
+			Branch: "master",
+			URL:    "https://github.com/snipem/monako-test.git",
+			config: &Config{Frontmatter: settings},
+		},
+		Commit: &OriginFileCommit{
+			Hash:   "abc",
+			Author: OriginFileCommitter{Name: "Jane", Email: "jane@example.com"},
+			Date:   time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC),
+		},
+	}
+}
+
+func TestFrontmatterMerge(t *testing.T) {
+
+	content := `---
+title: Readme
+weight: 10
+lastMod: 2019-01-01
+tags:
+  - b
+  - a
+---
+
+# Readme`
+
+	t.Run("Document wins", func(t *testing.T) {
+		result, err := getFrontmatterTestFile(FrontmatterConfig{}).ExpandFrontmatter(content)
+		assert.NoError(t, err)
+		assert.Equal(t, `---
+title: Readme
+weight: 10
+lastMod: "2019-01-01"
+tags:
+- b
+- a
+MonakoGitRemote: https://github.com/snipem/monako-test.git
+MonakoGitRemotePath: docs/README.md
+MonakoGitURL: https://github.com/snipem/monako-test/blob/master/docs/README.md
+MonakoGitEditURL: https://github.com/snipem/monako-test/edit/master/docs/README.md
+MonakoGitLastCommitHash: abc
+MonakoGitURLCommit: https://github.com/snipem/monako-test/commit/abc
+MonakoGitLastCommitAuthor: Jane
+MonakoGitLastCommitAuthorEmail: jane@example.com
+---
+
+# Readme`, result)
+	})
+
+	t.Run("Monako wins", func(t *testing.T) {
+		result, err := getFrontmatterTestFile(FrontmatterConfig{Precedence: PrecedenceMonako}).ExpandFrontmatter(content)
+		assert.NoError(t, err)
+		assert.Contains(t, result, "weight: 10\nlastMod: 2020-05-01T12:00:00Z\ntags:\n")
+		assert.NotContains(t, result, "2019-01-01")
+	})
+
+	t.Run("Keys are compared without case", func(t *testing.T) {
+		result, err := getFrontmatterTestFile(FrontmatterConfig{}).ExpandFrontmatter("---\nLastmod: 2019-01-01\n---\n# Readme")
+		assert.NoError(t, err)
+		assert.Contains(t, result, "Lastmod:")
+		assert.NotContains(t, result, "lastMod:")
+	})
+
+	t.Run("Invalid front matter", func(t *testing.T) {
+		_, err := getFrontmatterTestFile(FrontmatterConfig{}).ExpandFrontmatter("---\ntitle: [\n---\n# Readme")
+		assert.Error(t, err)
+	})
+}
+
+func TestFrontmatterKeepFormat(t *testing.T) {
+
+	t.Run("TOML", func(t *testing.T) {
+		result, err := getFrontmatterTestFile(FrontmatterConfig{KeepFormat: true}).ExpandFrontmatter(`+++
+title = "Readme"
+weight = 10
+
+[params]
+  color = "blue"
++++
+
+# Readme`)
+		assert.NoError(t, err)
+		assert.Contains(t, result, "+++\ntitle = \"Readme\"\nweight = 10\nMonakoGitRemote = ")
+		assert.Contains(t, result, "lastMod = 2020-05-01T12:00:00Z\n")
+		assert.Contains(t, result, "\n[params]\n  color = \"blue\"\n+++\n")
+
+		matter, _, err := parseFrontmatter(result)
+		assert.NoError(t, err)
+		assert.Equal(t, "title", matter.fields[0].Key)
+		assert.Equal(t, "params", matter.fields[len(matter.fields)-1].Key)
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		result, err := getFrontmatterTestFile(FrontmatterConfig{KeepFormat: true}).ExpandFrontmatter(`{
+  "title": "Readme",
+  "categories": ["Docs"],
+  "description": "Description"
+}
+
+# Readme`)
+		assert.NoError(t, err)
+		assert.Contains(t, result, "{\n  \"title\": \"Readme\",\n  \"categories\": [\n    \"Docs\"\n  ],\n  \"description\": \"Description\",\n  \"MonakoGitRemote\": ")
+		assert.Contains(t, result, "\"lastMod\": \"2020-05-01T12:00:00Z\"")
+
+		matter, body, err := parseFrontmatter(result)
+		assert.NoError(t, err)
+		assert.Equal(t, "title", matter.fields[0].Key)
+		assert.Contains(t, body, "# Readme")
+	})
+
+	t.Run("Converted to YAML by default", func(t *testing.T) {
+		result, err := getFrontmatterTestFile(FrontmatterConfig{}).ExpandFrontmatter("+++\ntitle = \"Readme\"\n+++\n# Readme")
+		assert.NoError(t, err)
+		assert.Contains(t, result, "---\ntitle: Readme\nMonakoGitRemote: ")
+	})
+
+	t.Run("YAML without front matter", func(t *testing.T) {
+		result, err := getFrontmatterTestFile(FrontmatterConfig{KeepFormat: true}).ExpandFrontmatter("# Readme")
+		assert.NoError(t, err)
+		assert.Contains(t, result, "---\nMonakoGitRemote: ")
+	})
+}
+
+func TestFrontmatterValidation(t *testing.T) {
+	configFile := writeTestConfig(t, `
+frontmatter:
+  precedence: author
+origins:
+  - src: https://github.com/snipem/monako-test.git
+    branch: master
+`)
+	_, err := LoadConfig(configFile, "")
+	assert.Error(t, err)
+	errs := err.(ConfigErrors)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "frontmatter.precedence", errs[0].Field)
+	assert.Equal(t, 3, errs[0].Line)
+	assert.Contains(t, errs[0].Message, "unknown precedence, use one of document, monako")
+}
+
+func TestFrontmatterRules(t *testing.T) {
+	config, _ := getTestConfig(t, Origin{
+		SourceDir:     "docs",
+		TargetDir:     "docs",
+		FileWhitelist: []string{".md"},
+		Frontmatter: &FrontmatterConfig{
+			Defaults: map[string]interface{}{"tags": []interface{}{"payments"}},
+			Rules: []FrontmatterRule{
+				{Match: "internal/**", Set: map[string]interface{}{"BookHidden": true}},
+				{Match: "**", WeightFromPrefix: true},
+			},
+		},
+	})
+	config.Frontmatter = FrontmatterConfig{
+		Defaults: map[string]interface{}{"tags": []interface{}{"docs"}, "draft": false},
+		Rules:    []FrontmatterRule{{Match: "**/*.md", Set: map[string]interface{}{"weight": 99}}},
+	}
+
+	filesystem := newTestFilesystem(t, map[string]string{
+		"docs/02-setup.md":                 "# Setup",
+		"docs/internal/README.md":          "---\ntitle: Internal\ntags: [secret]\n---\n# Internal",
+		"docs/internal/10_team/_index.md":  "# Team",
+		"docs/internal/10_team/members.md": "# Members",
+	})
+	assert.NoError(t, config.Origins[0].ComposeDir(context.Background(), filesystem))
+
+	read := func(name string) string {
+		content, err := ioutil.ReadFile(filepath.Join(config.ContentWorkingDir, "docs", name))
+		assert.NoError(t, err)
+		return string(content)
+	}
+
+	assert.Equal(t, "---\ndraft: false\ntags:\n- payments\nweight: 2\n---\n# Setup", read("02-setup.md"))
+	assert.Equal(t, "---\ntitle: Internal\ntags:\n- secret\ndraft: false\nweight: 99\nBookHidden: true\n---\n# Internal", read("internal/README.md"))
+	assert.Contains(t, read("internal/10_team/_index.md"), "weight: 10\nBookHidden: true\n")
+	assert.Contains(t, read("internal/10_team/members.md"), "weight: 99\nBookHidden: true\n")
+
+	t.Run("Match paths", func(t *testing.T) {
+		for _, tc := range []struct {
+			pattern, path string
+			matches       bool
+		}{
+			{"internal/**", "internal/README.md", true},
+			{"internal/**", "internal/a/b/c.md", true},
+			{"internal/**", "public/internal/README.md", false},
+			{"**/README.md", "README.md", true},
+			{"**/README.md", "a/b/README.md", true},
+			{"*.md", "a/README.md", false},
+			{"a/*/c.md", "a/b/c.md", true},
+			{"a/**/c.md", "a/c.md", true},
+		} {
+			assert.Equal(t, tc.matches, matchPath(tc.pattern, tc.path), "%s %s", tc.pattern, tc.path)
+		}
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		config.Origins[0].URL, config.Origins[0].Branch = "https://github.com/snipem/monako-test.git", "master"
+		config.Origins[0].Frontmatter.Rules = append(config.Origins[0].Frontmatter.Rules, FrontmatterRule{Match: "[a-"}, FrontmatterRule{})
+		errs := config.Validate()
+		assert.Len(t, errs, 2, errs.Error())
+		assert.Equal(t, "origins[0].frontmatter.rules[2].match", errs[0].Field)
+		assert.Contains(t, errs[0].Message, "invalid pattern")
+		assert.Equal(t, "origins[0].frontmatter.rules[3].match", errs[1].Field)
+	})
+}
@@ -0,0 +1,375 @@
+package compose
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// mailmapFileName is the file in the root of a repository mapping author names and emails
+const mailmapFileName = ".mailmap"
+
+// HistoryProvider is implemented by CommitInfoProviders knowing the history of files
+type HistoryProvider interface {
+	// History returns the last commits of the file at remotePath, newest first and at most limit,
+	// and the contributors of all commits to the file, most commits first
+	History(ctx context.Context, remotePath string, limit int) ([]OriginFileCommit, []OriginFileContributor, error)
+}
+
+// OriginFileContributor represents an author of commits to a file
+type OriginFileContributor struct {
+	Name    string `yaml:"name"`
+	Email   string `yaml:"email"`
+	Commits int    `yaml:"commits"`
+}
+
+// mailmapEntry maps the commit name and email of an author to the proper ones. Empty fields are not mapped
+type mailmapEntry struct {
+	properName  string
+	properEmail string
+	commitName  string
+	commitEmail string
+}
+
+// mailmap maps authors of commits like described in gitmailmap(5)
+type mailmap []mailmapEntry
+
+// mailmapEmail matches the emails of a mailmap line
+var mailmapEmail = regexp.MustCompile(`<([^>]*)>`)
+
+// parseMailmap returns the mailmap of the content of a .mailmap file. Invalid lines are ignored
+func parseMailmap(content string) mailmap {
+	var entries mailmap
+	for _, line := range strings.Split(content, "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		emails := mailmapEmail.FindAllStringSubmatchIndex(line, -1)
+		switch len(emails) {
+		case 1:
+			// Proper Name <commit@email>
+			entries = append(entries, mailmapEntry{
+				properName:  strings.TrimSpace(line[:emails[0][0]]),
+				commitEmail: line[emails[0][2]:emails[0][3]],
+			})
+		case 2:
+			// [Proper Name] <proper@email> [Commit Name] <commit@email>
+			entries = append(entries, mailmapEntry{
+				properName:  strings.TrimSpace(line[:emails[0][0]]),
+				properEmail: line[emails[0][2]:emails[0][3]],
+				commitName:  strings.TrimSpace(line[emails[0][1]:emails[1][0]]),
+				commitEmail: line[emails[1][2]:emails[1][3]],
+			})
+		}
+	}
+	return entries
+}
+
+// resolve returns the proper name and email of the author of a commit
+func (m mailmap) resolve(name string, email string) OriginFileCommitter {
+	author := OriginFileCommitter{Name: name, Email: email}
+
+	var match *mailmapEntry
+	for i := range m {
+		entry := &m[i]
+		if !strings.EqualFold(entry.commitEmail, email) {
+			continue
+		}
+		// Entries with a commit name are more specific
+		if entry.commitName == "" && match == nil {
+			match = entry
+		} else if strings.EqualFold(entry.commitName, name) {
+			match = entry
+			break
+		}
+	}
+
+	if match != nil {
+		if match.properName != "" {
+			author.Name = match.properName
+		}
+		if match.properEmail != "" {
+			author.Email = match.properEmail
+		}
+	}
+	return author
+}
+
+// readGitMailmap returns the mailmap of the checked out commit of the repository, nil if there is none
+func readGitMailmap(repo *git.Repository) mailmap {
+	head, err := repo.Head()
+	if err != nil {
+		return nil
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil
+	}
+	file, err := commit.File(mailmapFileName)
+	if err != nil {
+		return nil
+	}
+	content, err := file.Contents()
+	if err != nil {
+		log.Warnf("Can't read %s, authors are not mapped: %s", mailmapFileName, err)
+		return nil
+	}
+	return parseMailmap(content)
+}
+
+// History returns the last commits and the contributors of the file at remotePath.
+// Authors are mapped with the .mailmap of the repository
+func (commits *gitCommitInfo) History(ctx context.Context, remotePath string, limit int) ([]OriginFileCommit, []OriginFileContributor, error) {
+	commits.mailmapOnce.Do(func() {
+		commits.mailmap = readGitMailmap(commits.repo)
+	})
+	return getHistory(ctx, path.Join(commits.prefix, remotePath), commits.repo, limit, commits.mailmap)
+}
+
+// getHistory returns the last limit commits of the file in the repository and all of its contributors
+func getHistory(ctx context.Context, remotePath string, repo *git.Repository, limit int, authors mailmap) ([]OriginFileCommit, []OriginFileContributor, error) {
+
+	log.Debugf("Getting history for %s", remotePath)
+
+	if repo == nil {
+		return nil, nil, fmt.Errorf("Repository is nil")
+	}
+
+	cIter, err := repo.Log(&git.LogOptions{
+		FileName: &remotePath,
+		Order:    git.LogOrderCommitterTime,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error while opening %s from git log: %s", remotePath, err)
+	}
+	defer cIter.Close()
+
+	var history []OriginFileCommit
+	var contributors []OriginFileContributor
+	contributorIndex := map[string]int{}
+
+	err = cIter.ForEach(func(commit *object.Commit) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		author := authors.resolve(commit.Author.Name, commit.Author.Email)
+		if len(history) < limit {
+			history = append(history, OriginFileCommit{
+				Hash:    commit.Hash.String(),
+				Author:  author,
+				Date:    commit.Author.When,
+				Message: strings.TrimSpace(strings.SplitN(commit.Message, "\n", 2)[0]),
+			})
+		}
+
+		key := strings.ToLower(author.Email)
+		if key == "" {
+			key = strings.ToLower(author.Name)
+		}
+		if i, found := contributorIndex[key]; found {
+			contributors[i].Commits++
+		} else {
+			contributorIndex[key] = len(contributors)
+			contributors = append(contributors, OriginFileContributor{Name: author.Name, Email: author.Email, Commits: 1})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error while reading history of %s: %s", remotePath, err)
+	}
+
+	// Contributors with the same number of commits keep the order of their last commit
+	sort.SliceStable(contributors, func(i, j int) bool {
+		return contributors[i].Commits > contributors[j].Commits
+	})
+	return history, contributors, nil
+}
+
+// historyFields returns the history and the contributors of the file as front matter values
+func (file *OriginFile) historyFields() (history []yaml.MapSlice, contributors []yaml.MapSlice) {
+	for _, commit := range file.History {
+		history = append(history, yaml.MapSlice{
+			{Key: "hash", Value: commit.Hash},
+			{Key: "url", Value: getWebLinkForGitCommit(file.parentOrigin.URL, commit.Hash, file.parentOrigin.gitProviderHosts())},
+			{Key: "date", Value: commit.Date},
+			{Key: "author", Value: commit.Author.Name},
+			{Key: "email", Value: commit.Author.Email},
+			{Key: "message", Value: commit.Message},
+		})
+	}
+	for _, contributor := range file.Contributors {
+		contributors = append(contributors, yaml.MapSlice{
+			{Key: "name", Value: contributor.Name},
+			{Key: "email", Value: contributor.Email},
+			{Key: "commits", Value: contributor.Commits},
+		})
+	}
+	return history, contributors
+}
+
+// FirstCommitProvider is implemented by CommitInfoProviders knowing when files were created
+type FirstCommitProvider interface {
+	// FirstCommit returns the commit adding the file at remotePath
+	FirstCommit(ctx context.Context, remotePath string) (*OriginFileCommit, error)
+}
+
+// maxRenames limits the renames followed when looking for the first commit of a file
+const maxRenames = 20
+
+// FirstCommit returns the commit adding the file at remotePath, following renames
+func (commits *gitCommitInfo) FirstCommit(ctx context.Context, remotePath string) (*OriginFileCommit, error) {
+	return getFirstCommit(ctx, path.Join(commits.prefix, remotePath), commits.repo)
+}
+
+// lookupFirstCommit sets the first commit of the file, unless the front matter of the content sets
+// the date and the document takes precedence. Following a file to its first commit walks the whole
+// history, so it's only done when the date is needed
+func (file *OriginFile) lookupFirstCommit(ctx context.Context, content string) {
+	if file.FirstCommit != nil || file.Commit == nil || file.parentOrigin == nil {
+		return
+	}
+	firstCommitProvider, isFirstCommitProvider := file.parentOrigin.commits.(FirstCommitProvider)
+	if !isFirstCommitProvider {
+		return
+	}
+	if file.parentOrigin.frontmatterConfig().Precedence != PrecedenceMonako {
+		if matter, _, err := parseFrontmatter(content); err == nil && matter.has("date") {
+			log.Debugf("Skipping first commit of %s, the document sets a date", file.RemotePath)
+			return
+		}
+	}
+	firstCommit, err := firstCommitProvider.FirstCommit(ctx, file.RemotePath)
+	if err != nil {
+		log.Warnf("Can't extract first commit for '%s'", err)
+		return
+	}
+	file.FirstCommit = firstCommit
+}
+
+// getFirstCommit returns the commit adding the file to the repository. If the file has been
+// renamed, the commit adding it under its previous name is returned
+func getFirstCommit(ctx context.Context, remotePath string, repo *git.Repository) (*OriginFileCommit, error) {
+
+	log.Debugf("Getting first commit for %s", remotePath)
+
+	if repo == nil {
+		return nil, fmt.Errorf("Repository is nil")
+	}
+
+	from := plumbing.ZeroHash
+	for renames := 0; ; renames++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		first, err := getOldestCommit(ctx, repo, from, remotePath)
+		if err != nil {
+			return nil, err
+		}
+
+		previousPath, parent := getRenamedFrom(ctx, first, remotePath)
+		if previousPath == "" || renames == maxRenames {
+			return &OriginFileCommit{
+				Author: OriginFileCommitter{
+					Name:  first.Author.Name,
+					Email: first.Author.Email,
+				},
+				Date: first.Author.When,
+				Hash: first.Hash.String(),
+			}, nil
+		}
+		log.Debugf("%s has been renamed from %s in %s", remotePath, previousPath, first.Hash)
+		remotePath, from = previousPath, parent
+	}
+}
+
+// getOldestCommit returns the oldest commit touching the file that is reachable from the commit
+// given as from, or from HEAD if from is the zero hash
+func getOldestCommit(ctx context.Context, repo *git.Repository, from plumbing.Hash, remotePath string) (*object.Commit, error) {
+	if from == plumbing.ZeroHash {
+		head, err := repo.Head()
+		if err != nil {
+			return nil, fmt.Errorf("Error while opening %s from git log: %s", remotePath, err)
+		}
+		from = head.Hash()
+	}
+	start, err := repo.CommitObject(from)
+	if err != nil {
+		return nil, fmt.Errorf("Error while opening %s from git log: %s", remotePath, err)
+	}
+
+	// Like git log with a file name, but every walked commit checks the context and not only the ones touching the file
+	cIter := object.NewCommitPathIterFromIter(func(p string) bool {
+		return p == remotePath
+	}, &contextCommitIter{ctx: ctx, CommitIter: object.NewCommitIterCTime(start, nil, nil)}, false)
+	defer cIter.Close()
+
+	var oldest *object.Commit
+	err = cIter.ForEach(func(commit *object.Commit) error {
+		oldest = commit
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error while reading history of %s: %s", remotePath, err)
+	}
+	if oldest == nil {
+		return nil, fmt.Errorf("File not found in git log: '%s'", remotePath)
+	}
+	return oldest, nil
+}
+
+// contextCommitIter stops iterating commits when the context is done
+type contextCommitIter struct {
+	object.CommitIter
+	ctx context.Context
+}
+
+// Next returns the next commit or the error of the context if it is done
+func (iter *contextCommitIter) Next() (*object.Commit, error) {
+	if err := iter.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return iter.CommitIter.Next()
+}
+
+// getRenamedFrom returns the previous path of the file if the commit renamed it and the parent
+// commit containing the file under its previous path. The path is empty if there was no rename
+func getRenamedFrom(ctx context.Context, commit *object.Commit, remotePath string) (string, plumbing.Hash) {
+	if commit.NumParents() == 0 {
+		return "", plumbing.ZeroHash
+	}
+	parent, err := commit.Parent(0)
+	if err != nil {
+		return "", plumbing.ZeroHash
+	}
+	parentTree, err := parent.Tree()
+	if err != nil {
+		return "", plumbing.ZeroHash
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return "", plumbing.ZeroHash
+	}
+
+	changes, err := object.DiffTreeWithOptions(ctx, parentTree, tree, object.DefaultDiffTreeOptions)
+	if err != nil {
+		log.Debugf("Can't detect renames of %s in %s: %s", remotePath, commit.Hash, err)
+		return "", plumbing.ZeroHash
+	}
+	for _, change := range changes {
+		if change.To.Name == remotePath && change.From.Name != "" && change.From.Name != remotePath {
+			return change.From.Name, parent.Hash
+		}
+	}
+	return "", plumbing.ZeroHash
+}
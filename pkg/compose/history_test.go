@@ -0,0 +1,198 @@
+package compose
+
+// run: go test ./pkg/compose -run TestHistory
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+)
+
+// testCommit is a commit of a test repository writing files
+type testCommit struct {
+	files   map[string]string
+	name    string
+	email   string
+	message string
+	date    time.Time
+}
+
+// createTestGitRepository returns a Git repository in a temporary folder with the given commits
+func createTestGitRepository(t *testing.T, commits ...testCommit) string {
+	dir := writeTestFiles(t, nil)
+	repo, err := git.PlainInit(dir, false)
+	assert.NoError(t, err)
+	worktree, err := repo.Worktree()
+	assert.NoError(t, err)
+
+	for _, commit := range commits {
+		for name, content := range commit.files {
+			assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), standardFilemode))
+			assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), standardFilemode))
+			_, err = worktree.Add(name)
+			assert.NoError(t, err)
+		}
+		_, err = worktree.Commit(commit.message, &git.CommitOptions{
+			Author: &object.Signature{Name: commit.name, Email: commit.email, When: commit.date},
+		})
+		assert.NoError(t, err)
+	}
+	return dir
+}
+
+func TestHistoryMailmap(t *testing.T) {
+	authors := parseMailmap(`# Comment
+Jane Doe <jane@example.com>
+<john@example.com> <john@old.example.com>
+Jane Doe <jane@example.com> Jane <jane@old.example.com>
+Bot <bot@example.com> <ci@example.com> # Trailing comment
+invalid line
+`)
+	assert.Len(t, authors, 4)
+
+	for _, tc := range []struct {
+		name, email, expectedName, expectedEmail string
+	}{
+		{"jd", "Jane@Example.com", "Jane Doe", "Jane@Example.com"},
+		{"John", "john@old.example.com", "John", "john@example.com"},
+		{"jane", "jane@old.example.com", "Jane Doe", "jane@example.com"},
+		{"Someone else", "jane@old.example.com", "Someone else", "jane@old.example.com"},
+		{"ci", "ci@example.com", "Bot", "bot@example.com"},
+		{"Unknown", "unknown@example.com", "Unknown", "unknown@example.com"},
+	} {
+		t.Run(tc.name+" "+tc.email, func(t *testing.T) {
+			assert.Equal(t, OriginFileCommitter{Name: tc.expectedName, Email: tc.expectedEmail}, authors.resolve(tc.name, tc.email))
+		})
+	}
+
+	var empty mailmap
+	assert.Equal(t, OriginFileCommitter{Name: "jd", Email: "jd@example.com"}, empty.resolve("jd", "jd@example.com"))
+}
+
+func TestHistory(t *testing.T) {
+	date := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	dir := createTestGitRepository(t,
+		testCommit{map[string]string{"docs/README.md": "# One", ".mailmap": "Jane Doe <jane@example.com> <jane@old.example.com>\n"}, "Jane", "jane@old.example.com", "Add readme", date},
+		testCommit{map[string]string{"docs/README.md": "# Two"}, "John", "john@example.com", "Rename\n\nLonger description", date.Add(time.Hour)},
+		testCommit{map[string]string{"docs/other.md": "# Other"}, "Bot", "bot@example.com", "Add other", date.Add(2 * time.Hour)},
+		testCommit{map[string]string{"docs/README.md": "# Three"}, "Jane Doe", "jane@example.com", "Fix typo", date.Add(3 * time.Hour)},
+	)
+
+	config, _ := getTestConfig(t, Origin{Type: LocalSource, URL: filepath.Join(dir, "docs"), TargetDir: "docs"})
+	config.History = 2
+	origin := &config.Origins[0]
+	_, err := origin.Fetch(context.Background())
+	assert.NoError(t, err)
+
+	file := origin.newFile(context.Background(), "README.md")
+	assert.Len(t, file.History, 2)
+	assert.Equal(t, "Fix typo", file.History[0].Message)
+	assert.Equal(t, "Rename", file.History[1].Message)
+	assert.Equal(t, "John", file.History[1].Author.Name)
+	assert.Equal(t, []OriginFileContributor{
+		{Name: "Jane Doe", Email: "jane@example.com", Commits: 2},
+		{Name: "John", Email: "john@example.com", Commits: 1},
+	}, file.Contributors)
+
+	t.Run("Front matter", func(t *testing.T) {
+		origin.URL = "https://github.com/snipem/monako-test.git"
+		content, err := file.ExpandFrontmatter("# Three")
+		assert.NoError(t, err)
+		assert.Contains(t, content, "MonakoGitHistory:\n- hash: "+file.History[0].Hash+"\n  url: https://github.com/snipem/monako-test/commit/"+file.History[0].Hash)
+		assert.Contains(t, content, "  message: Fix typo\n")
+		assert.Contains(t, content, "MonakoGitContributors:\n- name: Jane Doe\n  email: jane@example.com\n  commits: 2\n")
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		config.History = 0
+		file := origin.newFile(context.Background(), "README.md")
+		assert.NotNil(t, file.Commit)
+		assert.Nil(t, file.History)
+		assert.Nil(t, file.Contributors)
+
+		content, err := file.ExpandFrontmatter("# Three")
+		assert.NoError(t, err)
+		assert.NotContains(t, content, "MonakoGitHistory")
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		config.History = -1
+		errs := config.Validate()
+		assert.Len(t, errs, 1)
+		assert.Equal(t, "history", errs[0].Field)
+	})
+}
+
+func TestHistoryFirstCommit(t *testing.T) {
+	date := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	dir := createTestGitRepository(t,
+		testCommit{map[string]string{"docs/old.md": "# Document\n\nWith enough content to be detected as rename"}, "Jane", "jane@example.com", "Add document", date},
+		testCommit{map[string]string{"docs/old.md": "# Document\n\nWith enough content to be detected as a rename"}, "John", "john@example.com", "Fix typo", date.Add(time.Hour)},
+	)
+
+	repo, err := git.PlainOpen(dir)
+	assert.NoError(t, err)
+	worktree, err := repo.Worktree()
+	assert.NoError(t, err)
+	_, err = worktree.Move("docs/old.md", "docs/README.md")
+	assert.NoError(t, err)
+	_, err = worktree.Commit("Rename document", &git.CommitOptions{
+		Author: &object.Signature{Name: "Bot", Email: "bot@example.com", When: date.Add(2 * time.Hour)},
+	})
+	assert.NoError(t, err)
+
+	config, _ := getTestConfig(t, Origin{Type: LocalSource, URL: filepath.Join(dir, "docs"), TargetDir: "docs"})
+	origin := &config.Origins[0]
+	_, err = origin.Fetch(context.Background())
+	assert.NoError(t, err)
+
+	file := origin.newFile(context.Background(), "README.md")
+	assert.Equal(t, "Bot", file.Commit.Author.Name)
+	assert.Nil(t, file.FirstCommit)
+
+	t.Run("Document sets the date", func(t *testing.T) {
+		file.lookupFirstCommit(context.Background(), "---\nDate: 2019-01-01\n---\n# Document")
+		assert.Nil(t, file.FirstCommit)
+	})
+
+	t.Run("Cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := origin.commits.(FirstCommitProvider).FirstCommit(ctx, "README.md")
+		assert.ErrorIs(t, err, context.Canceled)
+
+		_, err = getOldestCommit(ctx, repo, plumbing.ZeroHash, "docs/README.md")
+		assert.ErrorContains(t, err, "context canceled")
+	})
+
+	file.lookupFirstCommit(context.Background(), "# Document")
+	assert.Equal(t, "Jane", file.FirstCommit.Author.Name)
+	assert.True(t, date.Equal(file.FirstCommit.Date))
+
+	t.Run("Front matter", func(t *testing.T) {
+		content, err := file.ExpandFrontmatter("# Document")
+		assert.NoError(t, err)
+		assert.Contains(t, content, "date: 2020-05-01T12:00:00Z\nMonakoGitFirstCommitAuthor: Jane\nMonakoGitFirstCommitAuthorEmail: jane@example.com\n")
+	})
+
+	t.Run("Front matter of the document takes precedence", func(t *testing.T) {
+		content, err := file.ExpandFrontmatter("---\nDate: 2019-01-01\nMonakoGitFirstCommitAuthor: Jane Doe\n---\n# Document")
+		assert.NoError(t, err)
+		assert.NotContains(t, content, "2020-05-01T12:00:00Z")
+		assert.NotContains(t, content, "MonakoGitFirstCommitAuthor: Jane\n")
+		assert.Contains(t, content, "MonakoGitFirstCommitAuthorEmail: jane@example.com\n")
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		_, err := origin.commits.(FirstCommitProvider).FirstCommit(context.Background(), "missing.md")
+		assert.Error(t, err)
+	})
+}
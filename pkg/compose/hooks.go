@@ -0,0 +1,164 @@
+package compose
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// PreCompose hooks run before the origins are composed
+const PreCompose = "preCompose"
+
+// PostCompose hooks run after all origins have been composed
+const PostCompose = "postCompose"
+
+// PostRender hooks run after Hugo rendered the site without errors
+const PostRender = "postRender"
+
+// hookPoints are all lifecycle points in the order they are reached
+var hookPoints = []string{PreCompose, PostCompose, PostRender}
+
+// Hooks are commands run at the lifecycle points of a build
+type Hooks struct {
+	PreCompose  []Hook `yaml:"preCompose,omitempty"`
+	PostCompose []Hook `yaml:"postCompose,omitempty"`
+	PostRender  []Hook `yaml:"postRender,omitempty"`
+}
+
+// Hook is a command run at a lifecycle point. The paths of the build are given
+// as environment variables
+type Hook struct {
+	Command []string          `yaml:"command"`
+	Env     map[string]string `yaml:"env,omitempty"`
+	Timeout time.Duration     `yaml:"timeout,omitempty"`
+	// FailOnError fails the build if the command fails, otherwise a warning is logged
+	FailOnError bool `yaml:"failOnError,omitempty"`
+}
+
+// HookFunc is called at a lifecycle point of the build. Returned errors fail the build
+type HookFunc func(ctx context.Context, config *Config) error
+
+// AddHook adds a Go function called at the lifecycle point, after the hooks of the config.
+// An error is returned for unknown lifecycle points
+func (config *Config) AddHook(point string, hook HookFunc) error {
+	if !isHookPoint(point) {
+		return fmt.Errorf("unknown lifecycle point %q, use one of %s", point, strings.Join(hookPoints, ", "))
+	}
+	if config.hookFuncs == nil {
+		config.hookFuncs = make(map[string][]HookFunc)
+	}
+	config.hookFuncs[point] = append(config.hookFuncs[point], hook)
+	return nil
+}
+
+// isHookPoint returns true if point is a lifecycle point
+func isHookPoint(point string) bool {
+	for _, hookPoint := range hookPoints {
+		if point == hookPoint {
+			return true
+		}
+	}
+	return false
+}
+
+// hooks returns the configured hooks for the lifecycle point
+func (hooks Hooks) hooks(point string) []Hook {
+	switch point {
+	case PreCompose:
+		return hooks.PreCompose
+	case PostCompose:
+		return hooks.PostCompose
+	case PostRender:
+		return hooks.PostRender
+	}
+	return nil
+}
+
+// runHooks runs the configured hooks and the Go functions of the lifecycle point
+func (config *Config) runHooks(ctx context.Context, point string) error {
+
+	for _, hook := range config.Hooks.hooks(point) {
+		err := hook.run(ctx, point, config.hookEnv(point))
+		if err != nil && (hook.FailOnError || ctx.Err() != nil) {
+			return err
+		} else if err != nil {
+			log.Warnf("Ignoring failed %s hook: %s", point, err)
+		}
+	}
+
+	for _, hook := range config.hookFuncs[point] {
+		if err := hook(ctx, config); err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Error in %s hook", point))
+		}
+	}
+	return nil
+}
+
+// run runs the command of the hook. Its output is passed through
+func (hook Hook) run(ctx context.Context, point string, env []string) error {
+	if hook.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hook.Timeout)
+		defer cancel()
+	}
+
+	fmt.Printf("\nRunning %s hook '%s' ...\n", point, strings.Join(hook.Command, " "))
+
+	message, err := runCommand(ctx, hook.Command, append(env, sortedEnv(hook.Env)...), nil, os.Stdout)
+	if message != "" {
+		fmt.Fprintln(os.Stderr, message)
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%s hook %s timed out", point, hook.Command[0])
+	}
+	if err != nil {
+		if message != "" {
+			return fmt.Errorf("%s hook %s failed: %s: %s", point, hook.Command[0], err, message)
+		}
+		return fmt.Errorf("%s hook %s failed: %s", point, hook.Command[0], err)
+	}
+	return nil
+}
+
+// hookEnv returns the environment variables describing the build for hooks
+func (config *Config) hookEnv(point string) []string {
+	absolute := func(p string) string {
+		if absolutePath, err := filepath.Abs(p); err == nil {
+			return absolutePath
+		}
+		return p
+	}
+
+	return []string{
+		"MONAKO_HOOK=" + point,
+		"MONAKO_CONFIG=" + config.settings.ConfigFilePath,
+		"MONAKO_BASE_URL=" + config.BaseURL,
+		"MONAKO_COMPOSE_DIR=" + absolute(config.HugoWorkingDir),
+		"MONAKO_CONTENT_DIR=" + absolute(config.ContentWorkingDir),
+		"MONAKO_PUBLIC_DIR=" + absolute(filepath.Join(config.HugoWorkingDir, publicDirectory)),
+		"MONAKO_MANIFEST=" + absolute(config.manifestPath()),
+	}
+}
+
+// validateHooks checks that all hooks have a command and a valid timeout
+func (config *Config) validateHooks() ConfigErrors {
+	var errs ConfigErrors
+
+	for _, point := range hookPoints {
+		for i, hook := range config.Hooks.hooks(point) {
+			if len(hook.Command) == 0 || hook.Command[0] == "" {
+				errs = append(errs, config.configError("field is required", "hooks", point, i, "command"))
+			}
+			if hook.Timeout < 0 {
+				errs = append(errs, config.configError("timeout must not be negative", "hooks", point, i, "timeout"))
+			}
+		}
+	}
+	return errs
+}
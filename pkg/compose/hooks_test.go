@@ -0,0 +1,107 @@
+package compose
+
+// run: go test ./pkg/compose -run TestHooks
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHooks(t *testing.T) {
+
+	t.Run("Hooks run around composing", func(t *testing.T) {
+		config, _ := getTestConfig(t)
+		config.Hooks = Hooks{
+			PreCompose: []Hook{{
+				Command:     []string{"sh", "-c", `mkdir -p "$MONAKO_CONTENT_DIR/api" && echo "# $TITLE" > "$MONAKO_CONTENT_DIR/api/README.md"`},
+				Env:         map[string]string{"TITLE": "API"},
+				FailOnError: true,
+			}},
+			PostCompose: []Hook{{
+				Command:     []string{"sh", "-c", `test -f "$MONAKO_CONTENT_DIR/docs/monako-test/README.md" && echo "$MONAKO_HOOK" > "$MONAKO_COMPOSE_DIR/hook.txt"`},
+				FailOnError: true,
+			}},
+		}
+
+		var called []string
+		assert.NoError(t, config.AddHook(PostCompose, func(ctx context.Context, c *Config) error {
+			assert.Equal(t, config, c)
+			called = append(called, PostCompose)
+			return nil
+		}))
+
+		err := config.Compose(context.Background())
+		assert.NoError(t, err)
+
+		content, err := ioutil.ReadFile(filepath.Join(config.ContentWorkingDir, "api/README.md"))
+		assert.NoError(t, err)
+		assert.Equal(t, "# API\n", string(content))
+
+		content, err = ioutil.ReadFile(filepath.Join(config.HugoWorkingDir, "hook.txt"))
+		assert.NoError(t, err)
+		assert.Equal(t, "postCompose\n", string(content))
+		assert.Equal(t, []string{PostCompose}, called)
+	})
+
+	t.Run("Failing hooks", func(t *testing.T) {
+		config, _ := getTestConfig(t)
+		config.Hooks.PostRender = []Hook{{Command: []string{"sh", "-c", "echo upload failed >&2; exit 1"}}}
+
+		assert.NoError(t, config.runHooks(context.Background(), PostRender), "Failing hooks are ignored by default")
+
+		config.Hooks.PostRender[0].FailOnError = true
+		err := config.runHooks(context.Background(), PostRender)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "postRender hook sh failed: exit status 1: upload failed")
+
+		config.Hooks.PostRender = nil
+		assert.NoError(t, config.AddHook(PostRender, func(ctx context.Context, config *Config) error {
+			return errors.New("Go hook failed")
+		}))
+		err = config.runHooks(context.Background(), PostRender)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "Go hook failed")
+
+		err = config.AddHook("postRendered", func(ctx context.Context, config *Config) error {
+			return nil
+		})
+		assert.EqualError(t, err, `unknown lifecycle point "postRendered", use one of preCompose, postCompose, postRender`)
+	})
+
+	t.Run("Failing pre compose hook stops composing", func(t *testing.T) {
+		config, _ := getTestConfig(t)
+		config.Hooks.PreCompose = []Hook{{Command: []string{"false"}, FailOnError: true}}
+
+		err := config.Compose(context.Background())
+		assert.Error(t, err)
+		assert.NoDirExists(t, filepath.Join(config.ContentWorkingDir, "docs/monako-test"))
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		configFile := writeTestConfig(t, `
+hooks:
+  preCompose:
+    - command: [./generate-api-docs.sh]
+  postRender:
+    - env:
+        TARGET: s3://bucket
+      timeout: -1m
+origins:
+  - src: https://github.com/snipem/monako-test.git
+    branch: master
+`)
+		_, err := LoadConfig(configFile, "")
+		assert.Error(t, err)
+		errs := err.(ConfigErrors)
+		assert.Len(t, errs, 2)
+		assert.Equal(t, "hooks.postRender[0].command", errs[0].Field)
+		assert.Equal(t, 6, errs[0].Line)
+		assert.Equal(t, "hooks.postRender[0].timeout", errs[1].Field)
+		assert.Equal(t, 8, errs[1].Line)
+	})
+}
@@ -28,6 +28,11 @@ func extractTheme(hugoWorkingDir string) error {
 // createMonakoStructureInHugoFolder extracts the Monako theme and copies the hugoconfig and menuconfig to the needed files
 func createMonakoStructureInHugoFolder(composeConfig *Config, menuconfig string) error {
 
+	err := composeConfig.createWorkingDir()
+	if err != nil {
+		return err
+	}
+
 	var foldersToCreate = []string{"content", "themes"}
 	for _, folder := range foldersToCreate {
 		createDir := filepath.Join(composeConfig.ContentWorkingDir, folder)
@@ -37,7 +42,7 @@ func createMonakoStructureInHugoFolder(composeConfig *Config, menuconfig string)
 		}
 	}
 
-	err := extractTheme(composeConfig.HugoWorkingDir)
+	err = extractTheme(composeConfig.HugoWorkingDir)
 	if err != nil {
 		return errors.Wrap(err, fmt.Sprintf("Error extracting Hugo Theme"))
 	}
@@ -51,6 +56,85 @@ func createMonakoStructureInHugoFolder(composeConfig *Config, menuconfig string)
 	if err != nil {
 		return errors.Wrap(err, fmt.Sprintf("Error creating Monako menu config"))
 	}
+
+	err = createPagePartials(composeConfig)
+	if err != nil {
+		return errors.Wrap(err, "Error creating page partials")
+	}
+	return nil
+}
+
+// pageHeaderPartial is the partial the theme includes before the content of every page
+const pageHeaderPartial = "layouts/partials/docs/inject/content-before.html"
+
+// pageFooterPartial is the partial the theme includes after the content of every page
+const pageFooterPartial = "layouts/partials/docs/inject/content-after.html"
+
+// pageHeader shows a banner on stale documents
+const pageHeader = `{{/* Autogenerated by Monako, do not edit */}}
+{{ if .Params.MonakoGitStale }}
+<div class="monako-stale">
+  This page has not been updated since {{ .Lastmod.Format "2006-01-02" }} and may be outdated.
+</div>
+{{ end }}
+`
+
+// pageFooter shows the owners, the "edit this page" link, the creation and the history of documents.
+// All but the owners are hidden if MonakoGitLinks is false in the front matter of the document
+const pageFooter = `{{/* Autogenerated by Monako, do not edit */}}
+{{ with .Params.MonakoOwners }}
+<div class="monako-owners">
+  Owned by {{ delimit . ", " }}
+</div>
+{{ end }}
+{{ if ne .Params.MonakoGitLinks false }}
+{{ with .Params.MonakoGitEditURL }}
+<div class="monako-edit-link">
+  <a href="{{ . }}" target="_blank" rel="noopener">Edit this page</a>
+</div>
+{{ end }}
+{{ with .Params.MonakoGitFirstCommitAuthor }}
+<div class="monako-created">
+  Created by {{ . }} on {{ $.Date.Format "2006-01-02" }}
+</div>
+{{ end }}
+{{ with .Params.MonakoGitHistory }}
+<div class="monako-history">
+  <h2>History</h2>
+  <ul>
+  {{ range . }}
+    <li>
+      {{ with .url }}<a href="{{ . }}" target="_blank" rel="noopener">{{ end }}<code>{{ substr .hash 0 7 }}</code>{{ with .url }}</a>{{ end }}
+      {{ dateFormat "2006-01-02" .date }} {{ .author }}: {{ .message }}
+    </li>
+  {{ end }}
+  </ul>
+</div>
+{{ end }}
+{{ with .Params.MonakoGitContributors }}
+<div class="monako-contributors">
+  Contributors: {{ range $i, $contributor := . }}{{ if $i }}, {{ end }}{{ $contributor.name }}{{ end }}
+</div>
+{{ end }}
+{{ end }}
+`
+
+// createPagePartials creates the partials the theme includes before and after the content of every page
+func createPagePartials(composeConfig *Config) error {
+	for partial, content := range map[string]string{
+		pageHeaderPartial: pageHeader,
+		pageFooterPartial: pageFooter,
+	} {
+		dst := filepath.Join(composeConfig.HugoWorkingDir, filepath.FromSlash(partial))
+		err := os.MkdirAll(filepath.Dir(dst), standardFilemode)
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(dst, []byte(content), standardFilemode)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
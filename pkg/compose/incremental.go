@@ -0,0 +1,206 @@
+package compose
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// stateFileName is the name of the file in the compose folder recording the composed files
+const stateFileName = ".monako-state.json"
+
+// composeState records the files composed by a build
+type composeState struct {
+	// Files maps the paths of the composed files, relative to the compose folder, to their SHA-256 hash
+	Files map[string]string `json:"files"`
+}
+
+// incremental returns true if unchanged files are kept instead of composing from scratch
+func (config *Config) incremental() bool {
+	return config != nil && config.settings.Incremental
+}
+
+// statePath returns the path of the state file in the compose folder
+func (config *Config) statePath() string {
+	return filepath.Join(config.HugoWorkingDir, stateFileName)
+}
+
+// readComposeState returns the state of the last build. The state is empty if there is none
+func (config *Config) readComposeState() *composeState {
+	state := &composeState{Files: map[string]string{}}
+
+	data, err := ioutil.ReadFile(config.statePath())
+	if os.IsNotExist(err) {
+		return state
+	} else if err != nil {
+		log.Warnf("Can't read state of last build, composing from scratch: %s", err)
+		return state
+	}
+
+	if err = json.Unmarshal(data, state); err != nil || state.Files == nil {
+		log.Warnf("Can't parse state of last build %s, composing from scratch", config.statePath())
+		return &composeState{Files: map[string]string{}}
+	}
+	return state
+}
+
+// newComposeState returns the state of all composed origins
+func (config *Config) newComposeState() *composeState {
+	state := &composeState{Files: map[string]string{}}
+	for _, origin := range config.Origins {
+		for _, file := range origin.Files {
+			if localPath, err := filepath.Rel(config.HugoWorkingDir, file.LocalPath); err == nil {
+				state.Files[filepath.ToSlash(localPath)] = file.ContentHash
+			}
+		}
+	}
+	return state
+}
+
+// writeComposeState writes the state to the compose folder
+func (config *Config) writeComposeState(state *composeState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(config.statePath(), data, standardFilemode)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Error writing state %s", config.statePath()))
+	}
+	return nil
+}
+
+// removeStaleFiles removes the files composed by the last build that are not part of the
+// current state, for example because they have been deleted in their origin
+func (config *Config) removeStaleFiles(previous *composeState, current *composeState) error {
+	for localPath := range previous.Files {
+		if _, found := current.Files[localPath]; found {
+			continue
+		}
+
+		absolutePath := filepath.Join(config.HugoWorkingDir, filepath.FromSlash(localPath))
+		if err := checkInsideDir(config.ContentWorkingDir, absolutePath); err != nil {
+			log.Warnf("Not removing stale file: %s", err)
+			continue
+		}
+		err := os.Remove(absolutePath)
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, fmt.Sprintf("Error removing stale file %s", absolutePath))
+		}
+		fmt.Printf("Removed %s\n", absolutePath)
+		removeEmptyParentDirs(absolutePath, config.ContentWorkingDir)
+	}
+	return nil
+}
+
+// rollBack removes the incomplete output of a failed compose. Without incremental mode the
+// compose folder only contains this build and is removed. In incremental mode the files added
+// by this build are removed, the state of the last build stays valid for the files it records
+func (config *Config) rollBack(previous *composeState) {
+	if !config.incremental() {
+		if err := config.CleanUp(); err != nil {
+			log.Warnf("Can't remove incomplete compose folder: %s", err)
+		}
+		return
+	}
+
+	for absolutePath := range config.targets {
+		localPath, err := filepath.Rel(config.HugoWorkingDir, absolutePath)
+		if err != nil {
+			continue
+		}
+		if _, found := previous.Files[filepath.ToSlash(localPath)]; found {
+			continue
+		}
+		err = os.Remove(absolutePath)
+		if err != nil && !os.IsNotExist(err) {
+			log.Warnf("Can't remove incomplete file %s: %s", absolutePath, err)
+			continue
+		}
+		removeEmptyParentDirs(absolutePath, config.ContentWorkingDir)
+	}
+}
+
+// removeEmptyParentDirs removes the empty parent directories of path up to root
+func removeEmptyParentDirs(path string, root string) {
+	root = filepath.Clean(root)
+	for dir := filepath.Dir(path); dir != root && dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+		// Fails for directories that are not empty
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
+
+// hasContent returns true if the local file exists and has the given SHA-256 hash
+func hasContent(localPath string, contentHash string) bool {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, f); err != nil {
+		return false
+	}
+	return hex.EncodeToString(hash.Sum(nil)) == contentHash
+}
+
+// hashRemoteFile returns the SHA-256 hash of a file of the filesystem
+func hashRemoteFile(filesystem billy.Filesystem, remotePath string) (string, error) {
+	f, err := openRemoteFile(filesystem, remotePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// preserveModTimes sets the modification time of all files in newDir with the same content
+// as in oldDir to the modification time of the old file
+func preserveModTimes(oldDir string, newDir string) error {
+	return filepath.Walk(newDir, func(newPath string, newInfo os.FileInfo, err error) error {
+		if err != nil || newInfo.IsDir() {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(newDir, newPath)
+		if err != nil {
+			return err
+		}
+		oldPath := filepath.Join(oldDir, relativePath)
+		oldInfo, err := os.Stat(oldPath)
+		if err != nil || oldInfo.IsDir() || oldInfo.Size() != newInfo.Size() {
+			return nil
+		}
+
+		oldContent, err := ioutil.ReadFile(oldPath)
+		if err != nil {
+			return nil
+		}
+		newContent, err := ioutil.ReadFile(newPath)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(oldContent, newContent) {
+			return os.Chtimes(newPath, oldInfo.ModTime(), oldInfo.ModTime())
+		}
+		return nil
+	})
+}
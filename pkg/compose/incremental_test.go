@@ -0,0 +1,101 @@
+package compose
+
+// run: go test ./pkg/compose -run TestIncremental
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Flaque/filet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIncremental(t *testing.T) {
+
+	t.Run("Only changed files are rewritten", func(t *testing.T) {
+		// The local temp dir is within the Monako repository, use the temp dir of the system
+		dir := filet.TmpDir(t, "")
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, "images"), standardFilemode))
+		for name, content := range map[string]string{
+			"README.md":       "# Readme",
+			"guide.md":        "# Guide",
+			"images/logo.png": "png",
+		} {
+			assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), standardFilemode))
+		}
+
+		config, _ := getTestConfig(t, Origin{Type: LocalSource, URL: dir, TargetDir: "docs"})
+		config.settings.Incremental = true
+
+		assert.NoError(t, config.Compose(context.Background()))
+		assert.Len(t, config.readComposeState().Files, 3)
+
+		// Backdate all composed files to detect rewrites
+		lastBuild := time.Now().Add(-time.Hour).Truncate(time.Second)
+		for _, name := range []string{"docs/README.md", "docs/guide.md", "docs/images/logo.png"} {
+			assert.NoError(t, os.Chtimes(filepath.Join(config.ContentWorkingDir, name), lastBuild, lastBuild))
+		}
+
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "guide.md"), []byte("# Changed Guide"), standardFilemode))
+		assert.NoError(t, os.Remove(filepath.Join(dir, "images/logo.png")))
+
+		config.Origins[0].Files = nil
+		assert.NoError(t, config.Compose(context.Background()))
+
+		info, err := os.Stat(filepath.Join(config.ContentWorkingDir, "docs/README.md"))
+		assert.NoError(t, err)
+		assert.Equal(t, lastBuild, info.ModTime(), "Unchanged file keeps its modification time")
+
+		info, err = os.Stat(filepath.Join(config.ContentWorkingDir, "docs/guide.md"))
+		assert.NoError(t, err)
+		assert.True(t, info.ModTime().After(lastBuild), "Changed file is rewritten")
+		content, err := ioutil.ReadFile(filepath.Join(config.ContentWorkingDir, "docs/guide.md"))
+		assert.NoError(t, err)
+		assert.Contains(t, string(content), "# Changed Guide")
+
+		assert.NoFileExists(t, filepath.Join(config.ContentWorkingDir, "docs/images/logo.png"))
+		assert.NoDirExists(t, filepath.Join(config.ContentWorkingDir, "docs/images"), "Empty directories are removed")
+
+		state := config.readComposeState()
+		assert.Len(t, state.Files, 2)
+		assert.Contains(t, state.Files, "content/docs/README.md")
+	})
+
+	t.Run("Broken state composes from scratch", func(t *testing.T) {
+		config, _ := getTestConfig(t)
+		assert.NoError(t, os.MkdirAll(config.HugoWorkingDir, standardFilemode))
+		assert.NoError(t, ioutil.WriteFile(config.statePath(), []byte("{broken"), standardFilemode))
+
+		assert.Empty(t, config.readComposeState().Files)
+	})
+
+	t.Run("Unchanged pages keep their modification time", func(t *testing.T) {
+		oldDir := GetLocalTempDir(t)
+		newDir := GetLocalTempDir(t)
+		lastBuild := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+		for dir, pages := range map[string]map[string]string{
+			oldDir: {"index.html": "index", "page.html": "page"},
+			newDir: {"index.html": "index", "page.html": "changed page", "new.html": "new"},
+		} {
+			for name, content := range pages {
+				assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), standardFilemode))
+				if dir == oldDir {
+					assert.NoError(t, os.Chtimes(filepath.Join(dir, name), lastBuild, lastBuild))
+				}
+			}
+		}
+
+		assert.NoError(t, preserveModTimes(oldDir, newDir))
+
+		for name, preserved := range map[string]bool{"index.html": true, "page.html": false, "new.html": false} {
+			info, err := os.Stat(filepath.Join(newDir, name))
+			assert.NoError(t, err)
+			assert.Equal(t, preserved, info.ModTime().Equal(lastBuild), name)
+		}
+	})
+}
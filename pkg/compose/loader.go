@@ -0,0 +1,328 @@
+package compose
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// YAMLConfig identifies Monako configs written in YAML
+const YAMLConfig = "yaml"
+
+// TOMLConfig identifies Monako configs written in TOML
+const TOMLConfig = "toml"
+
+// JSONConfig identifies Monako configs written in JSON
+const JSONConfig = "json"
+
+// interpolationPattern matches $${ for escaping and ${VAR} or ${VAR:-default} for interpolation
+var interpolationPattern = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// configLoader reads config files and resolves their includes
+type configLoader struct {
+	// files maps every node to the config file it has been read from
+	files map[*yamlv3.Node]string
+	// loading contains the config files currently being loaded for detecting cycles
+	loading map[string]bool
+	errs    ConfigErrors
+}
+
+// loadConfigSource reads the config file with all of its includes and returns the merged
+// config source. The format of the config file is detected by its extension if format is
+// empty. Problems within the config files are returned as ConfigErrors, the returned
+// error is only set if the config file itself can't be read
+func loadConfigSource(configfilepath string, format string) (*configSource, ConfigErrors, error) {
+	loader := &configLoader{
+		files:   make(map[*yamlv3.Node]string),
+		loading: make(map[string]bool),
+	}
+
+	if format != "" && format != YAMLConfig && format != TOMLConfig && format != JSONConfig {
+		return nil, nil, fmt.Errorf("unknown config format %q, use %s, %s or %s", format, YAMLConfig, TOMLConfig, JSONConfig)
+	}
+
+	root, err := loader.load(configfilepath, format)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &configSource{
+		file:  configfilepath,
+		root:  &yamlv3.Node{Kind: yamlv3.DocumentNode, Content: []*yamlv3.Node{root}},
+		files: loader.files,
+	}, loader.errs, nil
+}
+
+// load reads a single config file, interpolates environment variables and merges
+// the files referenced by extends and include. Returns the resulting mapping node
+func (loader *configLoader) load(configfilepath string, format string) (*yamlv3.Node, error) {
+
+	absolutePath, err := filepath.Abs(configfilepath)
+	if err != nil {
+		return nil, err
+	}
+	if loader.loading[absolutePath] {
+		return nil, fmt.Errorf("include cycle detected for %s", configfilepath)
+	}
+	loader.loading[absolutePath] = true
+	defer delete(loader.loading, absolutePath)
+
+	data, err := ioutil.ReadFile(configfilepath)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == "" {
+		format = configFormat(configfilepath)
+	}
+
+	node, err := parseConfigNode(data, format)
+	if err != nil {
+		loader.errs = append(loader.errs, newConfigError(configfilepath, err))
+		return &yamlv3.Node{Kind: yamlv3.MappingNode}, nil
+	}
+
+	source := &configSource{file: configfilepath, root: node}
+	loader.errs = append(loader.errs, source.interpolate()...)
+	loader.errs = append(loader.errs, source.checkFields()...)
+	loader.errs = append(loader.errs, source.checkTypes()...)
+	loader.register(node, configfilepath)
+
+	mapping := node.Content[0]
+	if mapping.Kind != yamlv3.MappingNode {
+		return &yamlv3.Node{Kind: yamlv3.MappingNode}, nil
+	}
+
+	var includes []*yamlv3.Node
+	if extends := takeField(mapping, "extends"); extends != nil {
+		includes = append(includes, extends)
+	}
+	if include := takeField(mapping, "include"); include != nil {
+		includes = append(includes, include.Content...)
+	}
+
+	merged := &yamlv3.Node{Kind: yamlv3.MappingNode, Line: mapping.Line, Column: mapping.Column}
+	loader.files[merged] = configfilepath
+	for _, include := range includes {
+		if include.Kind != yamlv3.ScalarNode {
+			continue
+		}
+		includePath := include.Value
+		if !filepath.IsAbs(includePath) {
+			includePath = filepath.Join(filepath.Dir(configfilepath), includePath)
+		}
+		included, err := loader.load(includePath, "")
+		if err != nil {
+			loader.errs = append(loader.errs, ConfigError{
+				File:    configfilepath,
+				Line:    include.Line,
+				Message: fmt.Sprintf("can't include %q: %s", include.Value, err),
+			})
+			continue
+		}
+		mergeConfigNodes(merged, included)
+	}
+	mergeConfigNodes(merged, mapping)
+
+	return merged, nil
+}
+
+// configFormat returns the format of a config file based on its extension.
+// YAML is assumed for unknown extensions
+func configFormat(configfilepath string) string {
+	switch strings.ToLower(filepath.Ext(configfilepath)) {
+	case ".toml":
+		return TOMLConfig
+	case ".json":
+		return JSONConfig
+	default:
+		return YAMLConfig
+	}
+}
+
+// parseConfigNode parses a config of the given format into a document node containing a mapping.
+// JSON is a subset of YAML and parsed as such to keep line numbers after checking its syntax.
+// TOML is converted to YAML nodes without line numbers, as the TOML decoder doesn't expose the positions of keys
+func parseConfigNode(data []byte, format string) (*yamlv3.Node, error) {
+	var root yamlv3.Node
+
+	switch format {
+	case JSONConfig:
+		var value interface{}
+		if err := json.Unmarshal(data, &value); err != nil {
+			if syntaxErr, isSyntaxErr := err.(*json.SyntaxError); isSyntaxErr {
+				line := strings.Count(string(data[:syntaxErr.Offset]), "\n") + 1
+				return nil, fmt.Errorf("line %d: %s", line, err)
+			}
+			return nil, err
+		}
+		if err := yamlv3.Unmarshal(data, &root); err != nil {
+			return nil, err
+		}
+	case TOMLConfig:
+		var value map[string]interface{}
+		if _, err := toml.Decode(string(data), &value); err != nil {
+			return nil, err
+		}
+		var mapping yamlv3.Node
+		if err := mapping.Encode(value); err != nil {
+			return nil, err
+		}
+		root = yamlv3.Node{Kind: yamlv3.DocumentNode, Content: []*yamlv3.Node{&mapping}}
+	default:
+		if err := yamlv3.Unmarshal(data, &root); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(root.Content) == 0 {
+		// Empty config file
+		root = yamlv3.Node{Kind: yamlv3.DocumentNode, Content: []*yamlv3.Node{{Kind: yamlv3.MappingNode}}}
+	}
+	return &root, nil
+}
+
+// register stores the config file for the node and all its children
+func (loader *configLoader) register(node *yamlv3.Node, configfilepath string) {
+	loader.files[node] = configfilepath
+	for _, child := range node.Content {
+		loader.register(child, configfilepath)
+	}
+}
+
+// takeField removes the field with the given key from the mapping and returns its value
+func takeField(mapping *yamlv3.Node, key string) *yamlv3.Node {
+	i := mappingIndex(mapping, key)
+	if i < 0 {
+		return nil
+	}
+	value := mapping.Content[i+1]
+	mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+	return value
+}
+
+// mergeConfigNodes merges the mapping node override into the mapping node base.
+// Fields of override win over fields of base, mappings are merged recursively.
+// Origins with the same targetdir are merged, other origins are appended
+func mergeConfigNodes(base *yamlv3.Node, override *yamlv3.Node) {
+	for i := 0; i+1 < len(override.Content); i += 2 {
+		key, value := override.Content[i], override.Content[i+1]
+
+		j := mappingIndex(base, key.Value)
+		if j < 0 {
+			base.Content = append(base.Content, key, value)
+			continue
+		}
+
+		baseValue := base.Content[j+1]
+		switch {
+		case key.Value == "origins" && baseValue.Kind == yamlv3.SequenceNode && value.Kind == yamlv3.SequenceNode:
+			mergeOriginNodes(baseValue, value)
+		case baseValue.Kind == yamlv3.MappingNode && value.Kind == yamlv3.MappingNode:
+			mergeConfigNodes(baseValue, value)
+		default:
+			base.Content[j], base.Content[j+1] = key, value
+		}
+	}
+}
+
+// mergeOriginNodes merges the origins of override into the origins of base with the same key,
+// other origins are appended
+func mergeOriginNodes(base *yamlv3.Node, override *yamlv3.Node) {
+	for _, origin := range override.Content {
+		merged := false
+		for _, baseOrigin := range base.Content {
+			if origin.Kind == yamlv3.MappingNode && baseOrigin.Kind == yamlv3.MappingNode &&
+				originNodeKey(origin) == originNodeKey(baseOrigin) {
+				mergeConfigNodes(baseOrigin, origin)
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			base.Content = append(base.Content, origin)
+		}
+	}
+}
+
+// originNodeKey returns the key identifying an origin when merging: its id if set, otherwise
+// its src, branch and docdir
+func originNodeKey(origin *yamlv3.Node) string {
+	if id := mappingValue(origin, "id"); id != "" {
+		return "id " + id
+	}
+	return strings.Join([]string{
+		"src " + mappingValue(origin, "src"),
+		mappingValue(origin, "branch"),
+		path.Clean(filepath.ToSlash(mappingValue(origin, "docdir"))),
+	}, "\n")
+}
+
+// mappingValue returns the scalar value of the key in the mapping node, empty if not found
+func mappingValue(mapping *yamlv3.Node, key string) string {
+	if i := mappingIndex(mapping, key); i >= 0 {
+		return mapping.Content[i+1].Value
+	}
+	return ""
+}
+
+// mappingIndex returns the index of the key in the mapping node or -1 if not found
+func mappingIndex(mapping *yamlv3.Node, key string) int {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// interpolate replaces ${VAR} and ${VAR:-default} in all scalar values of the config
+// source with the values of the environment variables
+func (source *configSource) interpolate() ConfigErrors {
+	var errs ConfigErrors
+
+	var walk func(node *yamlv3.Node)
+	walk = func(node *yamlv3.Node) {
+		for _, child := range node.Content {
+			walk(child)
+		}
+		if node.Kind != yamlv3.ScalarNode || !strings.Contains(node.Value, "${") {
+			return
+		}
+
+		node.Value = interpolationPattern.ReplaceAllStringFunc(node.Value, func(match string) string {
+			if match == "$${" {
+				return "${"
+			}
+			groups := interpolationPattern.FindStringSubmatch(match)
+			value, isSet := os.LookupEnv(groups[1])
+			if value == "" && groups[2] != "" {
+				return groups[3]
+			}
+			if !isSet {
+				errs = append(errs, ConfigError{
+					File:    source.file,
+					Line:    node.Line,
+					Message: fmt.Sprintf("environment variable %q is not set and has no default", groups[1]),
+				})
+			}
+			return value
+		})
+
+		if node.Style&(yamlv3.SingleQuotedStyle|yamlv3.DoubleQuotedStyle|yamlv3.LiteralStyle|yamlv3.FoldedStyle) == 0 {
+			// Resolve the type of plain values again, for example booleans
+			node.Tag = ""
+		}
+	}
+	walk(source.root)
+
+	return errs
+}
@@ -0,0 +1,278 @@
+package compose
+
+// run: go test ./pkg/compose -run TestLoadConfigWith
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfigWithInterpolation(t *testing.T) {
+
+	os.Setenv("MONAKO_TEST_BASEURL", "https://staging.example.com/")
+	os.Setenv("MONAKO_TEST_EMPTY", "")
+	os.Setenv("MONAKO_TEST_DISABLE_COMMIT_INFO", "true")
+	defer os.Unsetenv("MONAKO_TEST_BASEURL")
+	defer os.Unsetenv("MONAKO_TEST_EMPTY")
+	defer os.Unsetenv("MONAKO_TEST_DISABLE_COMMIT_INFO")
+
+	t.Run("Variables and defaults", func(t *testing.T) {
+		dir := writeTestFiles(t, map[string]string{"config.yaml": `
+# Comments like ${NOT_INTERPOLATED} are ignored
+baseURL: ${MONAKO_TEST_BASEURL}
+title: "Docs for ${MONAKO_TEST_NOT_EXISTING:-everyone} $${ESCAPED}"
+disableCommitInfo: ${MONAKO_TEST_DISABLE_COMMIT_INFO}
+origins:
+  - src: https://github.com/snipem/monako-test.git
+    branch: ${MONAKO_TEST_EMPTY:-develop}
+    targetdir: docs/${MONAKO_TEST_EMPTY}
+`})
+		config, err := LoadConfig(filepath.Join(dir, "config.yaml"), dir)
+		assert.NoError(t, err)
+
+		assert.Equal(t, "https://staging.example.com/", config.BaseURL)
+		assert.Equal(t, "Docs for everyone ${ESCAPED}", config.Title)
+		assert.True(t, config.DisableCommitInfo)
+		assert.Equal(t, "develop", config.Origins[0].Branch)
+		assert.Equal(t, "docs/", config.Origins[0].TargetDir)
+	})
+
+	t.Run("Missing variable without default", func(t *testing.T) {
+		dir := writeTestFiles(t, map[string]string{"config.yaml": `
+origins:
+  - src: https://github.com/snipem/monako-test.git
+    branch: ${MONAKO_TEST_NOT_EXISTING}
+`})
+		_, err := LoadConfig(filepath.Join(dir, "config.yaml"), dir)
+		assert.Error(t, err)
+		errs := err.(ConfigErrors)
+		assert.Equal(t, 4, errs[0].Line)
+		assert.Contains(t, errs[0].Message, `"MONAKO_TEST_NOT_EXISTING" is not set`)
+	})
+}
+
+func TestLoadConfigWithIncludes(t *testing.T) {
+
+	t.Run("Extends and include", func(t *testing.T) {
+		dir := writeTestFiles(t, map[string]string{
+			"config.base.yaml": `
+baseURL: https://example.com/
+title: My Projects
+whitelist: [".md", ".png"]
+`,
+			"origins.yaml": `
+origins:
+  - src: https://github.com/snipem/monako-test.git
+    branch: master
+    targetdir: docs/test
+  - id: commute
+    src: https://github.com/snipem/commute-tube.git
+    branch: master
+    targetdir: docs/commute
+  - src: https://github.com/snipem/psnprices.git
+    branch: master
+    targetdir: docs/psnprices
+  - src: https://github.com/snipem/psnprices.git
+    branch: master
+    docdir: api
+    targetdir: docs/psnprices
+`,
+			"config.staging.yaml": `
+extends: config.base.yaml
+include:
+  - origins.yaml
+baseURL: https://staging.example.com/
+whitelist: [".md"]
+collisions: suffix
+origins:
+  - id: commute
+    branch: develop
+  - src: https://github.com/snipem/psnprices.git
+    docdir: ./api/
+    branch: master
+    targetdir: docs/psnprices/api
+  - src: https://github.com/snipem/monako-test.git
+    branch: master
+    targetdir: docs/test
+    docdir: docs
+`,
+		})
+
+		config, err := LoadConfig(filepath.Join(dir, "config.staging.yaml"), dir)
+		assert.NoError(t, err)
+
+		assert.Equal(t, "https://staging.example.com/", config.BaseURL)
+		assert.Equal(t, "My Projects", config.Title)
+		assert.Equal(t, []string{".md"}, config.FileWhitelist)
+
+		assert.Len(t, config.Origins, 5)
+		assert.Equal(t, "master", config.Origins[0].Branch)
+		assert.Equal(t, "https://github.com/snipem/commute-tube.git", config.Origins[1].URL)
+		assert.Equal(t, "develop", config.Origins[1].Branch, "Origins are merged by id")
+		assert.Equal(t, "", config.Origins[2].SourceDir)
+		assert.Equal(t, "./api/", config.Origins[3].SourceDir)
+		assert.Equal(t, "docs/psnprices/api", config.Origins[3].TargetDir, "Origins are merged by src, branch and docdir")
+		assert.Equal(t, "docs", config.Origins[4].SourceDir, "Origins with the same targetdir are not merged")
+	})
+
+	t.Run("Problems are reported for the included file", func(t *testing.T) {
+		dir := writeTestFiles(t, map[string]string{
+			"origins.yaml": `
+origins:
+  - src: https://github.com/snipem/monako-test.git
+    targetdir: docs/test
+`,
+			"config.yaml": `
+include: [origins.yaml]
+`,
+		})
+
+		_, err := LoadConfig(filepath.Join(dir, "config.yaml"), dir)
+		assert.Error(t, err)
+		errs := err.(ConfigErrors)
+		assert.Len(t, errs, 1)
+		assert.Equal(t, filepath.Join(dir, "origins.yaml"), errs[0].File)
+		assert.Equal(t, 3, errs[0].Line)
+		assert.Equal(t, "origins[0].branch", errs[0].Field)
+	})
+
+	t.Run("Missing include", func(t *testing.T) {
+		dir := writeTestFiles(t, map[string]string{"config.yaml": `
+extends: missing.yaml
+`})
+		_, err := LoadConfig(filepath.Join(dir, "config.yaml"), dir)
+		assert.Error(t, err)
+		errs := err.(ConfigErrors)
+		assert.Equal(t, 2, errs[0].Line)
+		assert.Contains(t, errs[0].Message, `can't include "missing.yaml"`)
+	})
+
+	t.Run("Include cycle", func(t *testing.T) {
+		dir := writeTestFiles(t, map[string]string{
+			"a.yaml": "extends: b.yaml\n",
+			"b.yaml": "extends: a.yaml\n",
+		})
+		_, err := LoadConfig(filepath.Join(dir, "a.yaml"), dir)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "include cycle detected")
+	})
+}
+
+func TestLoadConfigWithFormats(t *testing.T) {
+
+	dir := writeTestFiles(t, map[string]string{
+		"config.toml": `
+baseURL = "https://example.com/"
+title = "${MONAKO_TEST_NOT_EXISTING:-TOML Config}"
+whitelist = [".md", ".adoc"]
+include = ["origins.json"]
+
+[[origins]]
+src = "https://github.com/snipem/monako-test.git"
+branch = "master"
+docdir = "."
+targetdir = "docs/test"
+`,
+		"origins.json": `{
+	"origins": [
+		{
+			"src": "https://github.com/snipem/commute-tube.git",
+			"branch": "master",
+			"targetdir": "docs/commute"
+		}
+	]
+}`,
+		"config.invalid.json": `{
+	"origins": [
+		{
+			"src": "https://github.com/snipem/commute-tube.git",
+			"branch": "master",
+			"targetDir": "docs/commute"
+		}
+	]
+}`,
+		"config.broken.json": `{
+	"origins": [
+		{ "src": "https://github.com/snipem/commute-tube.git", }
+	]
+}`,
+		"config.invalid.toml": `
+[[origins]]
+src = "https://github.com/snipem/monako-test.git"
+branch = "master"
+target_dir = "docs/test"
+`,
+		"config.monako": `{"origins": [{"src": "https://github.com/snipem/monako-test.git", "branch": "master"}]}`,
+	})
+
+	t.Run("TOML with JSON include", func(t *testing.T) {
+		config, err := LoadConfig(filepath.Join(dir, "config.toml"), dir)
+		assert.NoError(t, err)
+
+		assert.Equal(t, "https://example.com/", config.BaseURL)
+		assert.Equal(t, "TOML Config", config.Title)
+		assert.Equal(t, []string{".md", ".adoc"}, config.FileWhitelist)
+		// Origins of included files come first
+		assert.Len(t, config.Origins, 2)
+		assert.Equal(t, "docs/commute", config.Origins[0].TargetDir)
+		assert.Equal(t, "docs/test", config.Origins[1].TargetDir)
+	})
+
+	t.Run("Unknown field in JSON with line number", func(t *testing.T) {
+		_, err := LoadConfig(filepath.Join(dir, "config.invalid.json"), dir)
+		assert.Error(t, err)
+		errs := err.(ConfigErrors)
+		assert.Len(t, errs, 1)
+		assert.Equal(t, 6, errs[0].Line)
+		assert.Equal(t, "origins[0].targetDir", errs[0].Field)
+	})
+
+	t.Run("JSON syntax error with line number", func(t *testing.T) {
+		_, err := LoadConfig(filepath.Join(dir, "config.broken.json"), dir)
+		assert.Error(t, err)
+		errs := err.(ConfigErrors)
+		assert.Equal(t, 3, errs[0].Line)
+	})
+
+	t.Run("Unknown field in TOML", func(t *testing.T) {
+		_, err := LoadConfig(filepath.Join(dir, "config.invalid.toml"), dir)
+		assert.Error(t, err)
+		errs := err.(ConfigErrors)
+		assert.Len(t, errs, 1)
+		assert.Equal(t, "origins[0].target_dir", errs[0].Field)
+		assert.Contains(t, errs[0].Message, `did you mean "targetdir"?`)
+		assert.Equal(t, 0, errs[0].Line, "TOML errors have no line numbers")
+	})
+
+	t.Run("TOML syntax error with line number", func(t *testing.T) {
+		configFile := filepath.Join(dir, "config.broken.toml")
+		assert.NoError(t, ioutil.WriteFile(configFile, []byte("title = \"Docs\"\n\n[[origins]\n"), 0600))
+		_, err := LoadConfig(configFile, dir)
+		assert.Error(t, err)
+		errs := err.(ConfigErrors)
+		assert.Equal(t, 3, errs[0].Line)
+	})
+
+	t.Run("Format given explicitly", func(t *testing.T) {
+		config, err := LoadConfigWithFormat(filepath.Join(dir, "config.monako"), JSONConfig, dir)
+		assert.NoError(t, err)
+		assert.Len(t, config.Origins, 1)
+	})
+
+	t.Run("Unknown format", func(t *testing.T) {
+		_, err := LoadConfigWithFormat(filepath.Join(dir, "config.monako"), "xml", dir)
+		assert.Error(t, err)
+	})
+}
+
+func TestConfigFormat(t *testing.T) {
+	assert.Equal(t, YAMLConfig, configFormat("config.monako.yaml"))
+	assert.Equal(t, YAMLConfig, configFormat("config.monako.yml"))
+	assert.Equal(t, YAMLConfig, configFormat("config"))
+	assert.Equal(t, TOMLConfig, configFormat("config.monako.TOML"))
+	assert.Equal(t, JSONConfig, configFormat("config.monako.json"))
+}
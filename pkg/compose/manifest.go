@@ -0,0 +1,193 @@
+package compose
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ManifestFileName is the name of the manifest in the compose folder
+const ManifestFileName = "monako-manifest.json"
+
+// Manifest describes the result of a build for downstream tooling
+type Manifest struct {
+	GeneratedAt time.Time        `json:"generatedAt"`
+	BaseURL     string           `json:"baseURL"`
+	Origins     []ManifestOrigin `json:"origins"`
+	// Pages are the URLs of all rendered pages, empty if the site has not been rendered
+	Pages []string `json:"pages,omitempty"`
+}
+
+// ManifestOrigin describes a composed origin
+type ManifestOrigin struct {
+	URL       string `json:"url"`
+	Type      string `json:"type"`
+	Branch    string `json:"branch,omitempty"`
+	Ref       string `json:"ref,omitempty"`
+	Commit    string `json:"commit,omitempty"`
+	SourceDir string `json:"docdir"`
+	TargetDir string `json:"targetdir"`
+
+	Files []ManifestFile `json:"files"`
+}
+
+// ManifestFile describes a composed file
+type ManifestFile struct {
+	RemotePath string `json:"remotePath"`
+	// LocalPath is relative to the compose folder
+	LocalPath   string `json:"localPath"`
+	Format      string `json:"format,omitempty"`
+	ContentHash string `json:"contentHash"`
+	// URL is the path of the page Hugo renders a document to
+	URL    string          `json:"url,omitempty"`
+	Commit *ManifestCommit `json:"commit,omitempty"`
+}
+
+// ManifestCommit describes the last commit of a file
+type ManifestCommit struct {
+	Hash        string    `json:"hash"`
+	Author      string    `json:"author"`
+	AuthorEmail string    `json:"authorEmail"`
+	Date        time.Time `json:"date"`
+}
+
+// manifestPath returns the path of the manifest in the compose folder
+func (config *Config) manifestPath() string {
+	return filepath.Join(config.HugoWorkingDir, ManifestFileName)
+}
+
+// newManifest returns the manifest for all composed origins
+func (config *Config) newManifest() *Manifest {
+	manifest := &Manifest{
+		GeneratedAt: time.Now().UTC(),
+		BaseURL:     config.BaseURL,
+		Origins:     []ManifestOrigin{},
+	}
+
+	for _, origin := range config.Origins {
+		originType := origin.Type
+		if originType == "" {
+			originType = GitSource
+		}
+		manifestOrigin := ManifestOrigin{
+			URL:       origin.URL,
+			Type:      originType,
+			Branch:    origin.Branch,
+			Ref:       origin.ref,
+			Commit:    origin.commit,
+			SourceDir: origin.SourceDir,
+			TargetDir: origin.TargetDir,
+			Files:     []ManifestFile{},
+		}
+
+		for _, file := range origin.Files {
+			manifestFile := ManifestFile{
+				RemotePath:  file.RemotePath,
+				LocalPath:   file.LocalPath,
+				Format:      file.GetFormat(),
+				ContentHash: file.ContentHash,
+			}
+			if localPath, err := filepath.Rel(config.HugoWorkingDir, file.LocalPath); err == nil {
+				manifestFile.LocalPath = filepath.ToSlash(localPath)
+			}
+			if manifestFile.Format != "" {
+				manifestFile.URL = hugoURL(file.contentPath())
+			}
+			if file.Commit != nil {
+				manifestFile.Commit = &ManifestCommit{
+					Hash:        file.Commit.Hash,
+					Author:      file.Commit.Author.Name,
+					AuthorEmail: file.Commit.Author.Email,
+					Date:        file.Commit.Date,
+				}
+			}
+			manifestOrigin.Files = append(manifestOrigin.Files, manifestFile)
+		}
+
+		manifest.Origins = append(manifest.Origins, manifestOrigin)
+	}
+	return manifest
+}
+
+// ReadManifest reads the manifest written by the last build in the compose folder
+func (config *Config) ReadManifest() (*Manifest, error) {
+	data, err := ioutil.ReadFile(config.manifestPath())
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{}
+	err = json.Unmarshal(data, manifest)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Error parsing %s", config.manifestPath()))
+	}
+	return manifest, nil
+}
+
+// writeManifest writes the manifest to the compose folder
+func (config *Config) writeManifest(manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(config.manifestPath(), data, standardFilemode)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Error writing manifest %s", config.manifestPath()))
+	}
+	return nil
+}
+
+// addPagesToManifest adds the URLs of all pages rendered to the public folder to the manifest.
+// A manifest without origins is written if the site has not been composed by Monako
+func (config *Config) addPagesToManifest() error {
+	manifest, err := config.ReadManifest()
+	if os.IsNotExist(err) {
+		manifest = &Manifest{BaseURL: config.BaseURL, Origins: []ManifestOrigin{}}
+	} else if err != nil {
+		return err
+	}
+
+	pages, err := renderedPages(filepath.Join(config.HugoWorkingDir, publicDirectory), config.BaseURL)
+	if err != nil {
+		return errors.Wrap(err, "Error listing rendered pages")
+	}
+	manifest.Pages = pages
+	manifest.GeneratedAt = time.Now().UTC()
+
+	return config.writeManifest(manifest)
+}
+
+// renderedPages returns the sorted URLs of all HTML pages in the public folder
+func renderedPages(publicDir string, baseURL string) ([]string, error) {
+	var pages []string
+
+	err := filepath.Walk(publicDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(filePath) != ".html" {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(publicDir, filePath)
+		if err != nil {
+			return err
+		}
+		urlPath := "/" + filepath.ToSlash(relativePath)
+		if path.Base(urlPath) == "index.html" {
+			urlPath = strings.TrimSuffix(urlPath, "index.html")
+		}
+		pages = append(pages, strings.TrimSuffix(baseURL, "/")+urlPath)
+		return nil
+	})
+
+	sort.Strings(pages)
+	return pages, err
+}
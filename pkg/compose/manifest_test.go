@@ -0,0 +1,79 @@
+package compose
+
+// run: go test ./pkg/compose -run TestManifest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifest(t *testing.T) {
+
+	t.Run("Compose writes origins and files", func(t *testing.T) {
+		config, _ := getTestConfig(t)
+
+		err := config.Compose(context.Background())
+		assert.NoError(t, err)
+
+		manifest, err := config.ReadManifest()
+		assert.NoError(t, err)
+		assert.Equal(t, "http://exampleurl.com", manifest.BaseURL)
+		assert.Len(t, manifest.Origins, 1)
+
+		origin := manifest.Origins[0]
+		assert.Equal(t, GitSource, origin.Type)
+		assert.Equal(t, "refs/heads/master", origin.Ref)
+		assert.Len(t, origin.Commit, 40)
+		assert.NotEmpty(t, origin.Files)
+
+		var readme *ManifestFile
+		for i := range origin.Files {
+			if origin.Files[i].RemotePath == "README.md" {
+				readme = &origin.Files[i]
+			}
+		}
+		if !assert.NotNil(t, readme, "README.md is in the manifest") {
+			return
+		}
+
+		assert.Equal(t, "content/docs/monako-test/README.md", readme.LocalPath)
+		assert.Equal(t, "MARKDOWN", readme.Format)
+		assert.Equal(t, "/docs/monako-test/readme/", readme.URL)
+		assert.NotNil(t, readme.Commit)
+
+		content, err := ioutil.ReadFile(filepath.Join(config.HugoWorkingDir, readme.LocalPath))
+		assert.NoError(t, err)
+		hash := sha256.Sum256(content)
+		assert.Equal(t, hex.EncodeToString(hash[:]), readme.ContentHash)
+	})
+
+	t.Run("Rendered pages", func(t *testing.T) {
+		config, _ := getTestConfig(t)
+		assert.NoError(t, os.MkdirAll(config.HugoWorkingDir, os.ModePerm))
+		assert.NoError(t, config.writeManifest(config.newManifest()))
+
+		publicDir := filepath.Join(config.HugoWorkingDir, publicDirectory)
+		for _, page := range []string{"index.html", "docs/index.html", "docs/page.html", "css/style.css"} {
+			assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(publicDir, page)), os.ModePerm))
+			assert.NoError(t, ioutil.WriteFile(filepath.Join(publicDir, page), []byte{}, standardFilemode))
+		}
+
+		assert.NoError(t, config.addPagesToManifest())
+
+		manifest, err := config.ReadManifest()
+		assert.NoError(t, err)
+		assert.Len(t, manifest.Origins, 1)
+		assert.Equal(t, []string{
+			"http://exampleurl.com/",
+			"http://exampleurl.com/docs/",
+			"http://exampleurl.com/docs/page.html",
+		}, manifest.Pages)
+	})
+}
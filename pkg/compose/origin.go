@@ -3,6 +3,7 @@ package compose
 // run: make test
 
 import (
+	"context"
 	"fmt"
 	"github.com/go-git/go-billy/v5"
 	"github.com/go-git/go-billy/v5/memfs"
@@ -10,11 +11,14 @@ import (
 	"github.com/go-git/go-git/v5/plumbing"
 	"os"
 	"path"
+	"time"
 
 	"github.com/gohugoio/hugo/hugofs/files"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/go-git/go-git/v5/storage/memory"
 	"github.com/snipem/monako/pkg/helpers"
@@ -26,14 +30,21 @@ const Asciidoc = "ASCIIDOC"
 // Markdown is a const for identifying Markdown Documents
 const Markdown = "MARKDOWN"
 
-// CloneDir clones a HTTPS or lokal Git repository with the given branch and optional username and password.
-// A virtual filesystem is returned containing the cloned files.
+// CloneDir fetches the origin with the fetcher registered for its type, without a timeout or cancellation.
+//
+// Deprecated: Use Fetch
 func (origin *Origin) CloneDir() (filesystem billy.Filesystem, err error) {
+	return origin.Fetch(context.Background())
+}
+
+// fetchGit clones a HTTPS or lokal Git repository with the given branch and optional username and password.
+// A virtual filesystem is returned containing the cloned files. Cloning is aborted if the context is done.
+func fetchGit(ctx context.Context, origin *Origin) (billy.Filesystem, CommitInfoProvider, error) {
 
 	fmt.Printf("\nCloning in to '%s' with branch '%s' ...\n", origin.URL, origin.Branch)
 	log.Debugf("Start cloning of %s", origin.URL)
 
-	filesystem = memfs.New()
+	filesystem := memfs.New()
 
 	basicauth := http.BasicAuth{}
 
@@ -50,13 +61,21 @@ func (origin *Origin) CloneDir() (filesystem billy.Filesystem, err error) {
 
 	depth := 0
 
-	if origin.config.DisableCommitInfo {
+	if origin.config.DisableCommitInfo || origin.planning {
 		// problem with depth = 1 is that git log from older commits, can't be accessed
-		// since CommitInfo is disabled anyway, use depth = 1 for speed boost
+		// since CommitInfo is disabled or not looked up while planning, use depth = 1 for speed boost
 		depth = 1
 	}
 
-	repo, err := git.Clone(memory.NewStorage(), filesystem, &git.CloneOptions{
+	if origin.planning {
+		commit, err := resolveBranch(ctx, origin, &basicauth)
+		if err != nil {
+			return nil, nil, err
+		}
+		log.Debugf("Branch %s of %s is at %s", origin.Branch, origin.URL, commit)
+	}
+
+	repo, err := git.CloneContext(ctx, memory.NewStorage(), filesystem, &git.CloneOptions{
 		URL:           origin.URL,
 		Depth:         depth,
 		ReferenceName: plumbing.ReferenceName(fmt.Sprintf("refs/heads/%s", origin.Branch)),
@@ -65,18 +84,37 @@ func (origin *Origin) CloneDir() (filesystem billy.Filesystem, err error) {
 	})
 
 	if err != nil {
-		return nil, errors.Wrap(err, fmt.Sprintf("Error while cloning into %s", origin.URL))
+		return nil, nil, errors.Wrap(err, fmt.Sprintf("Error while cloning into %s", origin.URL))
 	}
 
-	origin.repo = repo
 	log.Debugf("Ended cloning of %s", origin.URL)
 
-	return filesystem, nil
+	return filesystem, &gitCommitInfo{repo: repo}, nil
 
 }
 
+// resolveBranch returns the commit the branch of the origin points to, like git ls-remote
+func resolveBranch(ctx context.Context, origin *Origin, auth transport.AuthMethod) (string, error) {
+	remote := git.NewRemote(memory.NewStorage(), &gitconfig.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{origin.URL}})
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("Error listing branches of %s", origin.URL))
+	}
+	branch := plumbing.NewBranchReferenceName(origin.Branch)
+	for _, ref := range refs {
+		if ref.Name() == branch {
+			return ref.Hash().String(), nil
+		}
+	}
+	return "", fmt.Errorf("branch %q not found in %s", origin.Branch, origin.URL)
+}
+
 // Origin contains all information for a document origin
 type Origin struct {
+	// ID identifies the origin when merging included config files
+	ID string `yaml:"id,omitempty"`
+	// Type selects the fetcher for src, for example git, local, archive or http. Standard is git
+	Type          string   `yaml:"type,omitempty"`
 	URL           string   `yaml:"src"`
 	Branch        string   `yaml:"branch,omitempty"`
 	EnvUsername   string   `yaml:"envusername,omitempty"`
@@ -86,24 +124,88 @@ type Origin struct {
 	FileWhitelist []string `yaml:"whitelist,omitempty"`
 	FileBlacklist []string `yaml:"blacklist,omitempty"`
 
-	Files []OriginFile
+	// Processors transform the documents of this origin in the given order
+	Processors []ProcessorConfig `yaml:"processors,omitempty"`
+
+	// Timeout limits the time for cloning and composing this origin
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+
+	// Frontmatter adds defaults and rules for the front matter of the documents of this origin
+	Frontmatter *FrontmatterConfig `yaml:"frontmatter,omitempty"`
+
+	// Staleness overrides the days after which documents of this origin are stale, 0 disables it
+	Staleness *StalenessConfig `yaml:"staleness,omitempty"`
 
-	repo   *git.Repository
-	config *Config
+	// Owner owns the documents of this origin not matched by the CODEOWNERS of the repository
+	Owner string `yaml:"owner,omitempty"`
+
+	// RepoSettings replaces the policy of the config for the files in the docdir of this origin
+	RepoSettings *RepoSettingsPolicy `yaml:"repoSettings,omitempty"`
+
+	// DisableEditLinks removes the "edit this page" links from the documents of this origin
+	DisableEditLinks bool `yaml:"disableEditLinks,omitempty"`
+
+	// Discover makes this origin a template for all repositories found by the discovery
+	Discover *Discovery `yaml:"discover,omitempty"`
+
+	Files []OriginFile `yaml:"-"`
+
+	commits  CommitInfoProvider
+	pipeline []Processor
+	config   *Config
+
+	// repoFiles are the settings read from the files in the docdir
+	repoFiles repoSettings
+
+	// ref and commit are the fetched revision, if known
+	ref    string
+	commit string
+
+	// planning skips command processors and lookups of the commit information while computing a plan
+	planning bool
 }
 
 // ComposeDir copies a subdir of a virtual filesystem to a target in the local relative filesystem.
-// The copied files can be limited by a whitelist. The Git repository is used to obtain Git commit
-// information
-func (origin *Origin) ComposeDir(filesystem billy.Filesystem) error {
-	origin.Files = origin.getMatchingFiles(origin.SourceDir, filesystem)
+// The copied files can be limited by a whitelist. The commit info of the fetcher is used to obtain commit
+// information. Documents are transformed by the processors of the origin. Composing stops if the
+// context is done.
+func (origin *Origin) ComposeDir(ctx context.Context, filesystem billy.Filesystem) error {
+	for _, dir := range []string{origin.SourceDir, origin.TargetDir} {
+		if problem := checkRelativePath(dir); problem != "" {
+			return fmt.Errorf("%s of %s %s", dir, origin.URL, problem)
+		}
+	}
+
+	err := origin.initPipeline()
+	if err != nil {
+		return err
+	}
+
+	origin.readRepoSettings(filesystem)
+	files, err := origin.getMatchingFiles(ctx, origin.SourceDir, filesystem)
+	if err != nil {
+		return err
+	}
+	origin.Files = files
 
 	if len(origin.Files) == 0 {
 		log.Printf("Found no matching files in '%s' with branch '%s' in folder '%s'\n", origin.URL, origin.Branch, origin.SourceDir)
 	}
 
-	for _, file := range origin.Files {
-		err := file.composeFile(filesystem)
+	for i := range origin.Files {
+		file := &origin.Files[i]
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := checkInsideDir(origin.config.ContentWorkingDir, file.LocalPath); err != nil {
+			return err
+		}
+		if err := origin.config.claimLocalPath(file); err != nil {
+			return err
+		}
+		err := file.composeFile(ctx, filesystem)
+		// Files are kept for the manifest, the filesystem must not
+		file.filesystem = nil
 		if err != nil {
 			return errors.Wrap(err, fmt.Sprintf("Error composing file %s", file.RemotePath))
 		}
@@ -111,6 +213,24 @@ func (origin *Origin) ComposeDir(filesystem billy.Filesystem) error {
 	return nil
 }
 
+// initPipeline creates the processors of the origin, the default processors are used if it has none.
+// The frontmatter processor runs last unless the processors of the origin list it, so the other
+// processors don't change the added fields
+func (origin *Origin) initPipeline() error {
+	processorConfigs := origin.Processors
+	if processorConfigs == nil {
+		processorConfigs = defaultProcessors
+	} else if !hasProcessor(processorConfigs, FrontmatterProcessor) {
+		processorConfigs = append(append([]ProcessorConfig{}, processorConfigs...), ProcessorConfig{Name: FrontmatterProcessor})
+	}
+	pipeline, err := newPipeline(processorConfigs, origin.config.AllowedCommands)
+	if err != nil {
+		return err
+	}
+	origin.pipeline = pipeline
+	return nil
+}
+
 // NewOrigin returns a new origin with all needed fields
 func NewOrigin(url string, branch string, sourceDir string, targetDir string) *Origin {
 	o := new(Origin)
@@ -121,41 +241,65 @@ func NewOrigin(url string, branch string, sourceDir string, targetDir string) *O
 	return o
 }
 
-func (origin *Origin) getMatchingFiles(startdir string, filesystem billy.Filesystem) []OriginFile {
+func (origin *Origin) getMatchingFiles(ctx context.Context, startdir string, filesystem billy.Filesystem) ([]OriginFile, error) {
 
 	var originFiles []OriginFile
 
 	files, _ := filesystem.ReadDir(startdir)
 	for _, file := range files {
 
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		// This is the path as stored in the remote repo
 		// This can only be gathered here, because of recursing through
 		// the file system
 		// Use path here to support unixoid Git paths
 		remotePath := path.Join(startdir, file.Name())
 
+		if origin.isIgnored(remotePath, file.IsDir()) {
+			continue
+		}
+
+		if file.Mode()&os.ModeSymlink != 0 {
+			resolved, err := resolveRemotePath(filesystem, remotePath)
+			if err != nil {
+				log.Warnf("Skipping %s: %s", remotePath, err)
+				continue
+			}
+			if target, err := filesystem.Stat(resolved); err != nil || target.IsDir() {
+				// Symlinks to directories are not followed
+				log.Debugf("Skipping symlink %s", remotePath)
+				continue
+			}
+		}
+
 		if file.IsDir() {
 			// Recurse over file and add their files to originFiles
-			originFiles = append(
-				originFiles,
-				origin.getMatchingFiles(
-					remotePath,
-					filesystem,
-				)...)
+			subdirFiles, err := origin.getMatchingFiles(
+				ctx,
+				remotePath,
+				filesystem,
+			)
+			if err != nil {
+				return nil, err
+			}
+			originFiles = append(originFiles, subdirFiles...)
 		} else if helpers.FileIsListed(file.Name(), origin.FileWhitelist) &&
 			!helpers.FileIsListed(file.Name(), origin.FileBlacklist) {
 
 			// Add the current file to the list of files returned
 			originFiles = append(
 				originFiles,
-				origin.newFile(remotePath))
+				origin.newFile(ctx, remotePath))
 		}
 
 	}
-	return originFiles
+	return originFiles, nil
 }
 
-func (origin *Origin) newFile(remotePath string) OriginFile {
+func (origin *Origin) newFile(ctx context.Context, remotePath string) OriginFile {
 	localPath := getLocalFilePath(origin.config.ContentWorkingDir, origin.SourceDir, origin.TargetDir, remotePath)
 
 	originFile := OriginFile{
@@ -165,20 +309,38 @@ func (origin *Origin) newFile(remotePath string) OriginFile {
 		parentOrigin: origin,
 	}
 
-	if !origin.config.DisableCommitInfo {
+	if !origin.config.DisableCommitInfo && origin.commits != nil {
 
 		// Only get commit info for content files
 		// This speeds up commit fetching on repository with lots of files
 		// heavily. Most non content files are static and therefore way back
 		// in the commit log. This also reduces the calls to git log.
-		if files.IsContentFile(remotePath) {
+		if files.IsContentFile(remotePath) && origin.planning {
+			// The commit information is not looked up while planning
+			originFile.unplanned = true
+		} else if files.IsContentFile(remotePath) {
 			// TODO add safe way to acces not existing commit info
-			commitinfo, err := getCommitInfo(remotePath, origin.repo)
+			commitinfo, err := origin.commits.CommitInfo(ctx, remotePath)
 			if err != nil {
 				log.Warnf("Can't extract Commit Info for '%s'", err)
 			}
 			originFile.Commit = commitinfo
 
+			if historyProvider, isHistoryProvider := origin.commits.(HistoryProvider); isHistoryProvider && origin.config.History > 0 {
+				originFile.History, originFile.Contributors, err = historyProvider.History(ctx, remotePath, origin.config.History)
+				if err != nil {
+					log.Warnf("Can't extract history for '%s'", err)
+				}
+			}
+		}
+	}
+
+	if files.IsContentFile(remotePath) {
+		if ownersProvider, isOwnersProvider := origin.commits.(OwnersProvider); isOwnersProvider {
+			originFile.Owners = ownersProvider.Owners(remotePath)
+		}
+		if len(originFile.Owners) == 0 && origin.Owner != "" {
+			originFile.Owners = []string{origin.Owner}
 		}
 	}
 
@@ -3,6 +3,7 @@ package compose
 // run: MONAKO_TEST_REPO="/tmp/testdata/monako-test" go test ./pkg/compose/
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -42,22 +43,45 @@ func TestCleanUp(t *testing.T) {
 		"testfile.txt")
 
 	// Create the test data because it is not existing yet
-	err := os.Mkdir(config.HugoWorkingDir, standardFilemode)
+	err := config.createWorkingDir()
 	assert.NoError(t, err)
 
 	t.Logf("Using temp file %s", tmpFile)
 	_ = ioutil.WriteFile(tmpFile, []byte("none"), standardFilemode)
 
 	assert.FileExists(t, tmpFile, "File is existing that is to be cleaned up")
-	config.CleanUp()
+	err = config.CleanUp()
+	assert.NoError(t, err)
 	assert.NoFileExists(t, tmpFile, "File seems not to be cleaned up, is stil present")
 
+	t.Run("Refuse to clean up dir not created by Monako", func(t *testing.T) {
+		config, _ := getTestConfig(t)
+		assert.NoError(t, os.Mkdir(config.HugoWorkingDir, standardFilemode))
+		assert.NoError(t, config.CleanUp(), "Empty dirs are removed")
+
+		assert.NoError(t, os.Mkdir(config.HugoWorkingDir, standardFilemode))
+		tmpFile := filepath.Join(config.HugoWorkingDir, "important.txt")
+		assert.NoError(t, ioutil.WriteFile(tmpFile, []byte("important"), standardFilemode))
+
+		err := config.CleanUp()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "was not created by Monako")
+		assert.FileExists(t, tmpFile)
+
+		assert.Error(t, config.createWorkingDir(), "Compose refuses dirs not created by Monako")
+	})
+
+	t.Run("Refuse to clean up current dir", func(t *testing.T) {
+		config.HugoWorkingDir = "."
+		assert.Error(t, config.CleanUp())
+	})
+
 }
 
 func TestGitCommiter(t *testing.T) {
 
 	config, _ := getTestConfig(t)
-	err := config.Compose()
+	err := config.Compose(context.Background())
 	assert.NoError(t, err)
 	origins := config.Origins
 	firstOrigin := origins[0]
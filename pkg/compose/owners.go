@@ -0,0 +1,212 @@
+package compose
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// codeownersFileNames are the locations of CODEOWNERS files in a repository, in the order
+// GitHub and GitLab look them up
+var codeownersFileNames = []string{".github/CODEOWNERS", ".gitlab/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// OwnersProvider is implemented by CommitInfoProviders knowing the owners of files
+type OwnersProvider interface {
+	// Owners returns the owners of the file at remotePath, empty if it has none
+	Owners(remotePath string) []string
+}
+
+// codeownersRule assigns owners to the files matching a pattern
+type codeownersRule struct {
+	pattern string
+	owners  []string
+}
+
+// codeownersSection is a section of a GitLab CODEOWNERS file. GitHub files have a single section
+type codeownersSection struct {
+	name          string
+	defaultOwners []string
+	rules         []codeownersRule
+}
+
+// codeowners maps files to their owners like a CODEOWNERS file of GitHub or GitLab
+type codeowners []codeownersSection
+
+// codeownersSectionHeader matches GitLab section headers like "[Docs]", "^[Optional][2] @owner"
+var codeownersSectionHeader = regexp.MustCompile(`^\^?\[([^\]]+)\](?:\[\d+\])?(.*)$`)
+
+// parseCodeowners returns the rules of the content of a CODEOWNERS file
+func parseCodeowners(content string) codeowners {
+	sections := codeowners{{}}
+	current := 0
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if match := codeownersSectionHeader.FindStringSubmatch(line); match != nil {
+			current = sections.section(strings.TrimSpace(match[1]))
+			if defaultOwners := codeownersFields(match[2]); len(defaultOwners) > 0 {
+				sections[current].defaultOwners = defaultOwners
+			}
+			continue
+		}
+
+		fields := codeownersFields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		section := &sections[current]
+		owners := fields[1:]
+		if len(owners) == 0 {
+			owners = section.defaultOwners
+		}
+		section.rules = append(section.rules, codeownersRule{pattern: fields[0], owners: owners})
+	}
+	return sections
+}
+
+// section returns the index of the section with the name, which is added if it doesn't exist.
+// Like GitLab, sections with the same name are combined
+func (c *codeowners) section(name string) int {
+	for i, section := range *c {
+		if i > 0 && strings.EqualFold(section.name, name) {
+			return i
+		}
+	}
+	*c = append(*c, codeownersSection{name: name})
+	return len(*c) - 1
+}
+
+// codeownersFields splits a line into the pattern and the owners. Comments are removed and
+// escaped spaces and hashes are kept in the pattern
+func codeownersFields(line string) []string {
+	var fields []string
+	var field strings.Builder
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			field.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '#':
+			if field.Len() > 0 {
+				fields = append(fields, field.String())
+			}
+			return fields
+		case r == ' ' || r == '\t':
+			if field.Len() > 0 {
+				fields = append(fields, field.String())
+				field.Reset()
+			}
+		default:
+			field.WriteRune(r)
+		}
+	}
+	if field.Len() > 0 {
+		fields = append(fields, field.String())
+	}
+	return fields
+}
+
+// owners returns the owners of the file at the path relative to the root of the repository.
+// The last matching rule of every section wins, the owners of all sections are combined
+func (c codeowners) owners(p string) []string {
+	var owners []string
+	seen := map[string]bool{}
+	for _, section := range c {
+		for i := len(section.rules) - 1; i >= 0; i-- {
+			if !matchCodeownersPattern(section.rules[i].pattern, p) {
+				continue
+			}
+			for _, owner := range section.rules[i].owners {
+				if !seen[strings.ToLower(owner)] {
+					seen[strings.ToLower(owner)] = true
+					owners = append(owners, owner)
+				}
+			}
+			break
+		}
+	}
+	return owners
+}
+
+// matchCodeownersPattern matches a path against a CODEOWNERS pattern, which follows the rules of
+// gitignore: patterns without a slash match at any depth and patterns naming a folder match
+// all files within it. Patterns ending with a glob like docs/* only match direct children
+func matchCodeownersPattern(pattern string, p string) bool {
+	folderOnly := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+	if strings.HasPrefix(pattern, "/") {
+		pattern = strings.TrimPrefix(pattern, "/")
+	} else if !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+	if pattern == "" {
+		return false
+	}
+
+	patternElements := strings.Split(pattern, "/")
+	elements := strings.Split(p, "/")
+	if !folderOnly && globCharacters.MatchString(patternElements[len(patternElements)-1]) {
+		return matchPathElements(patternElements, elements)
+	}
+	for i := len(elements); i > 0; i-- {
+		if folderOnly && i == len(elements) {
+			continue
+		}
+		if matchPathElements(patternElements, elements[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// readGitCodeowners returns the CODEOWNERS of the checked out commit of the repository, nil if there is none
+func readGitCodeowners(repo *git.Repository) codeowners {
+	head, err := repo.Head()
+	if err != nil {
+		return nil
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil
+	}
+	for _, name := range codeownersFileNames {
+		file, err := commit.File(name)
+		if err != nil {
+			continue
+		}
+		content, err := file.Contents()
+		if err != nil {
+			log.Warnf("Can't read %s, owners are not added: %s", name, err)
+			return nil
+		}
+		log.Debugf("Using owners of %s", name)
+		return parseCodeowners(content)
+	}
+	return nil
+}
+
+// Owners returns the owners of the file at remotePath given by the CODEOWNERS of the repository
+func (commits *gitCommitInfo) Owners(remotePath string) []string {
+	commits.codeownersOnce.Do(func() {
+		commits.codeowners = readGitCodeowners(commits.repo)
+	})
+	return commits.codeowners.owners(path.Join(commits.prefix, remotePath))
+}
+
+// ownerFields returns the owners of the file as front matter fields
+func (file *OriginFile) ownerFields() yaml.MapSlice {
+	if len(file.Owners) == 0 {
+		return nil
+	}
+	return yaml.MapSlice{{Key: "MonakoOwners", Value: file.Owners}}
+}
@@ -0,0 +1,121 @@
+package compose
+
+// run: go test ./pkg/compose -run TestOwners
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOwnersCodeowners(t *testing.T) {
+	owners := parseCodeowners(`# Comment
+*                     @global-owner
+*.adoc                @asciidoc-owner # Trailing comment
+/docs/                @docs-team
+docs/internal/**      @internal-team jane@example.com
+README.md             @readme-owner
+docs/my\ file.md      @space-owner
+
+[Security][2] @security-team
+docs/security/
+docs/security/keys.md @keys-owner
+
+^[Optional]
+**/*.md               @optional-owner
+
+[security]
+docs/SECURITY.md
+`)
+
+	for _, tc := range []struct {
+		path     string
+		expected []string
+	}{
+		{"main.go", []string{"@global-owner"}},
+		{"guide.adoc", []string{"@asciidoc-owner"}},
+		{"docs/guide.adoc", []string{"@docs-team"}},
+		{"docs/a/b/guide.md", []string{"@docs-team", "@optional-owner"}},
+		{"docs/internal/team/members.md", []string{"@internal-team", "jane@example.com", "@optional-owner"}},
+		{"docs/README.md", []string{"@readme-owner", "@optional-owner"}},
+		{"docs/my file.md", []string{"@space-owner", "@optional-owner"}},
+		{"docs/security/guide.adoc", []string{"@docs-team", "@security-team"}},
+		{"docs/security/keys.md", []string{"@docs-team", "@keys-owner", "@optional-owner"}},
+		{"docs/SECURITY.md", []string{"@docs-team", "@security-team", "@optional-owner"}},
+		{"other/docs/guide.adoc", []string{"@asciidoc-owner"}},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			assert.Equal(t, tc.expected, owners.owners(tc.path))
+		})
+	}
+
+	var empty codeowners
+	assert.Nil(t, empty.owners("docs/README.md"))
+}
+
+func TestOwnersMatchPattern(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, path string
+		matches       bool
+	}{
+		{"*", "a/b/c.md", true},
+		{"*.md", "a/b/c.md", true},
+		{"/*.md", "a/b/c.md", false},
+		{"/*.md", "c.md", true},
+		{"docs", "docs/c.md", true},
+		{"docs", "a/docs/c.md", true},
+		{"docs/", "docs", false},
+		{"docs/", "a/docs/c.md", true},
+		{"/docs/", "a/docs/c.md", false},
+		{"a/docs", "x/a/docs/c.md", false},
+		{"docs/*", "docs/a/c.md", false},
+		{"docs/*", "docs/c.md", true},
+		{"docs/**", "docs/a/c.md", true},
+		{"*.md", "docs/c.md/d.txt", false},
+		{"docs/**/c.md", "docs/c.md", true},
+		{"/", "c.md", false},
+	} {
+		assert.Equal(t, tc.matches, matchCodeownersPattern(tc.pattern, tc.path), "%s %s", tc.pattern, tc.path)
+	}
+}
+
+func TestOwners(t *testing.T) {
+	date := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	dir := createTestGitRepository(t,
+		testCommit{map[string]string{
+			".github/CODEOWNERS": "/docs/team/ @team\n",
+			"CODEOWNERS":         "* @ignored\n",
+			"docs/README.md":     "# Readme",
+			"docs/team/guide.md": "# Guide",
+		}, "Jane", "jane@example.com", "Add docs", date},
+	)
+
+	config, _ := getTestConfig(t, Origin{Type: LocalSource, URL: filepath.Join(dir, "docs"), TargetDir: "docs", Owner: "@fallback"})
+	origin := &config.Origins[0]
+	_, err := origin.Fetch(context.Background())
+	assert.NoError(t, err)
+
+	file := origin.newFile(context.Background(), "team/guide.md")
+	assert.Equal(t, []string{"@team"}, file.Owners)
+
+	readme := origin.newFile(context.Background(), "README.md")
+	assert.Equal(t, []string{"@fallback"}, readme.Owners)
+
+	t.Run("Front matter", func(t *testing.T) {
+		withoutCommit := file
+		withoutCommit.Commit = nil
+		content, err := withoutCommit.ExpandFrontmatter("---\ntitle: Guide\n---\n# Guide")
+		assert.NoError(t, err)
+		assert.Equal(t, "---\ntitle: Guide\nMonakoOwners:\n- '@team'\n---\n# Guide", content)
+	})
+
+	t.Run("Without owners", func(t *testing.T) {
+		origin.Owner = ""
+		readme := origin.newFile(context.Background(), "README.md")
+		assert.Nil(t, readme.Owners)
+		assert.Nil(t, readme.ownerFields())
+	})
+}
@@ -0,0 +1,159 @@
+package compose
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/pkg/errors"
+)
+
+// markerFileName is the file marking a compose folder as created by Monako
+const markerFileName = ".monako"
+
+// maxSymlinks limits the symlinks followed when resolving a path
+const maxSymlinks = 40
+
+// createWorkingDir creates the compose folder and marks it as created by Monako. Existing
+// folders not created by Monako are refused, because they are removed by CleanUp
+func (config *Config) createWorkingDir() error {
+	if isMonakoDir(config.HugoWorkingDir) {
+		return nil
+	}
+
+	entries, err := ioutil.ReadDir(config.HugoWorkingDir)
+	if err == nil && len(entries) > 0 {
+		return fmt.Errorf("%s exists and was not created by Monako", config.HugoWorkingDir)
+	}
+
+	err = os.MkdirAll(config.HugoWorkingDir, standardFilemode)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Error creating compose folder %s", config.HugoWorkingDir))
+	}
+	err = ioutil.WriteFile(filepath.Join(config.HugoWorkingDir, markerFileName), []byte("Created by Monako, removed with every build\n"), standardFilemode)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("Error marking compose folder %s", config.HugoWorkingDir))
+	}
+	return nil
+}
+
+// isMonakoDir returns true if the folder has been created by Monako. Folders of older
+// versions are recognized by the generated Hugo config
+func isMonakoDir(dir string) bool {
+	if _, err := os.Stat(filepath.Join(dir, markerFileName)); err == nil {
+		return true
+	}
+	hugoConfig, err := ioutil.ReadFile(filepath.Join(dir, "config.toml"))
+	return err == nil && bytes.HasPrefix(hugoConfig, []byte("# Autogenerated by Monako"))
+}
+
+// checkInsideDir returns an error if the path is not within dir
+func checkInsideDir(dir string, p string) error {
+	relativePath, err := filepath.Rel(dir, p)
+	if err != nil || relativePath == ".." || strings.HasPrefix(relativePath, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s is outside of %s", p, dir)
+	}
+	return nil
+}
+
+// resolveRemotePath returns the path within the filesystem the remote path refers to after
+// following all symlinks. Paths and symlinks pointing outside of the filesystem are refused
+func resolveRemotePath(filesystem billy.Filesystem, remotePath string) (string, error) {
+	remotePath = path.Clean(filepath.ToSlash(remotePath))
+	if path.IsAbs(remotePath) || remotePath == ".." || strings.HasPrefix(remotePath, "../") {
+		return "", fmt.Errorf("%s points outside of the origin", remotePath)
+	}
+
+	linker, supportsSymlinks := filesystem.(billy.Symlink)
+	if !supportsSymlinks {
+		return remotePath, nil
+	}
+
+	resolved := ""
+	remaining := strings.Split(remotePath, "/")
+	for followed := 0; len(remaining) > 0; {
+		current := path.Join(resolved, remaining[0])
+		remaining = remaining[1:]
+
+		info, err := linker.Lstat(current)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			// Files that don't exist are reported when opening them
+			resolved = current
+			continue
+		}
+
+		followed++
+		if followed > maxSymlinks {
+			return "", fmt.Errorf("%s has too many levels of symlinks", remotePath)
+		}
+		target, err := linker.Readlink(current)
+		if err != nil {
+			return "", err
+		}
+		target = filepath.ToSlash(target)
+		next := path.Join(resolved, target)
+		if path.IsAbs(target) || filepath.IsAbs(target) || next == ".." || strings.HasPrefix(next, "../") {
+			return "", fmt.Errorf("symlink %s points outside of the origin", current)
+		}
+
+		// Resolve the target of the symlink from the start
+		resolved = ""
+		remaining = append(strings.Split(next, "/"), remaining...)
+	}
+	return resolved, nil
+}
+
+// openRemoteFile opens a file of the filesystem. Symlinks pointing outside of the filesystem are refused
+func openRemoteFile(filesystem billy.Filesystem, remotePath string) (billy.File, error) {
+	resolved, err := resolveRemotePath(filesystem, remotePath)
+	if err != nil {
+		return nil, err
+	}
+	return filesystem.Open(resolved)
+}
+
+// matchPath returns true if the slash separated path matches the pattern. Elements are matched
+// like path.Match, ** matches any number of folders
+func matchPath(pattern string, p string) bool {
+	return matchPathElements(strings.Split(pattern, "/"), strings.Split(p, "/"))
+}
+
+// matchPathElements matches the elements of a path against the elements of a pattern
+func matchPathElements(pattern []string, elements []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(elements); i++ {
+				if matchPathElements(pattern[1:], elements[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(elements) == 0 {
+			return false
+		}
+		if matched, err := path.Match(pattern[0], elements[0]); err != nil || !matched {
+			return false
+		}
+		pattern, elements = pattern[1:], elements[1:]
+	}
+	return len(elements) == 0
+}
+
+// checkPathPattern returns a description of the problem if the pattern is invalid, empty otherwise
+func checkPathPattern(pattern string) string {
+	if pattern == "" {
+		return "field is required"
+	}
+	for _, element := range strings.Split(pattern, "/") {
+		if _, err := path.Match(element, ""); err != nil {
+			return fmt.Sprintf("invalid pattern: %s", err)
+		}
+	}
+	return ""
+}
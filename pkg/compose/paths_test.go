@@ -0,0 +1,103 @@
+package compose
+
+// run: go test ./pkg/compose -run TestPaths
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathsResolveRemotePath(t *testing.T) {
+	filesystem := memfs.New()
+	assert.NoError(t, util.WriteFile(filesystem, "docs/README.md", []byte("# Readme"), standardFilemode))
+	for link, target := range map[string]string{
+		"docs/link.md":     "README.md",
+		"docs/parent.md":   "../docs/link.md",
+		"docs/escape.md":   "../../etc/passwd",
+		"docs/absolute.md": "/etc/passwd",
+		"shared":           "/etc",
+		"docs/via.md":      "../shared/passwd",
+		"docs/loop.md":     "loop.md",
+	} {
+		assert.NoError(t, filesystem.Symlink(target, link))
+	}
+
+	for remotePath, expected := range map[string]string{
+		"docs/README.md":           "docs/README.md",
+		"docs/link.md":             "docs/README.md",
+		"docs/parent.md":           "docs/README.md",
+		"./docs/../docs/README.md": "docs/README.md",
+		"docs/missing.md":          "docs/missing.md",
+		"../outside.md":            "",
+		"docs/../../outside.md":    "",
+		"docs/escape.md":           "",
+		"docs/absolute.md":         "",
+		"docs/via.md":              "",
+		"docs/loop.md":             "",
+		"/etc/passwd":              "",
+	} {
+		t.Run(remotePath, func(t *testing.T) {
+			resolved, err := resolveRemotePath(filesystem, remotePath)
+			if expected == "" {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, expected, resolved)
+			}
+		})
+	}
+}
+
+func TestPathsCompose(t *testing.T) {
+
+	t.Run("Symlinks pointing outside of local origins are skipped", func(t *testing.T) {
+		outside := writeTestFiles(t, map[string]string{"secret.md": "# Secret"})
+		dir := writeTestFiles(t, map[string]string{"README.md": "# Readme"})
+		assert.NoError(t, os.Symlink(filepath.Join(outside, "secret.md"), filepath.Join(dir, "secret.md")))
+		assert.NoError(t, os.Symlink("README.md", filepath.Join(dir, "index.md")))
+
+		config, _ := getTestConfig(t, Origin{Type: LocalSource, URL: dir, TargetDir: "docs"})
+		assert.NoError(t, config.Compose(context.Background()))
+
+		assert.NoFileExists(t, filepath.Join(config.ContentWorkingDir, "docs/secret.md"))
+		content, err := ioutil.ReadFile(filepath.Join(config.ContentWorkingDir, "docs/index.md"))
+		assert.NoError(t, err)
+		assert.Contains(t, string(content), "# Readme")
+	})
+
+	t.Run("Includes outside of the origin are refused", func(t *testing.T) {
+		filesystem := newTestFilesystem(t, map[string]string{"docs/README.md": "{{#include ../../etc/passwd}}"})
+		config, _ := getTestConfig(t, Origin{
+			SourceDir:     "docs",
+			TargetDir:     "docs",
+			FileWhitelist: []string{".md"},
+			Processors:    []ProcessorConfig{{Name: IncludeProcessor}},
+		})
+
+		err := config.Origins[0].ComposeDir(context.Background(), filesystem)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "points outside of the origin")
+	})
+
+	t.Run("Target dirs outside of the content dir are refused", func(t *testing.T) {
+		config, _ := getTestConfig(t, Origin{SourceDir: "docs", TargetDir: "../../escape", FileWhitelist: []string{".md"}})
+
+		err := config.Origins[0].ComposeDir(context.Background(), newTestFilesystem(t, map[string]string{"docs/README.md": "# Readme"}))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "must not contain '..'")
+	})
+
+	t.Run("Check inside dir", func(t *testing.T) {
+		assert.NoError(t, checkInsideDir("compose/content", "compose/content/docs/README.md"))
+		assert.Error(t, checkInsideDir("compose/content", "compose/README.md"))
+		assert.Error(t, checkInsideDir("compose/content", "compose/content/../../README.md"))
+		assert.NoError(t, checkInsideDir("compose/content", "compose/content/..README.md"))
+	})
+}
@@ -0,0 +1,257 @@
+package compose
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Changes of files in a plan compared to the current compose folder
+const (
+	// PlanAdd is a file that does not exist in the compose folder
+	PlanAdd = "add"
+	// PlanChange is a file with a different content in the compose folder
+	PlanChange = "change"
+	// PlanKeep is a file with the same content in the compose folder
+	PlanKeep = "keep"
+	// PlanRemove is a file composed by the last build that is no longer part of an origin
+	PlanRemove = "remove"
+	// PlanUnknown is a file in the compose folder whose content depends on commands or the commit
+	// information, which are skipped while planning
+	PlanUnknown = "unknown"
+)
+
+// Plan describes what composing would change in the compose folder
+type Plan struct {
+	Origins []PlanOrigin
+	// Removed are the files composed by the last build that would be removed,
+	// relative to the compose folder
+	Removed []string
+	// Collisions are the target paths more than one origin composes to
+	Collisions []PlanCollision
+}
+
+// PlanOrigin describes the files an origin would compose
+type PlanOrigin struct {
+	URL    string
+	Branch string
+	// Commit is the resolved commit of the origin, if known
+	Commit string
+	Files  []PlanFile
+	// Commands are the commands of the processors that would run for the documents
+	Commands []string
+}
+
+// PlanFile describes a file that would be composed
+type PlanFile struct {
+	RemotePath string
+	// LocalPath is the target path relative to the compose folder
+	LocalPath string
+	// Change is one of PlanAdd, PlanChange, PlanKeep and PlanUnknown
+	Change string
+}
+
+// PlanCollision describes a target path more than one origin composes to
+type PlanCollision struct {
+	LocalPath string
+	// Sources are the origin URLs and remote paths of the colliding files
+	Sources []string
+}
+
+// Plan resolves the origins and computes the files that would be composed without
+// writing anything. The files are compared to the current compose folder
+func (config *Config) Plan(ctx context.Context) (*Plan, error) {
+
+	err := config.DiscoverOrigins(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{}
+	planned := map[string]bool{}
+	sources := map[string][]string{}
+
+	for i := range config.Origins {
+		origin := &config.Origins[i]
+		config.applyDefaults(origin)
+
+		planOrigin, err := origin.plan(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range planOrigin.Files {
+			planned[file.LocalPath] = true
+			sources[file.LocalPath] = append(sources[file.LocalPath], fmt.Sprintf("%s %s", origin.URL, file.RemotePath))
+		}
+		plan.Origins = append(plan.Origins, planOrigin)
+	}
+
+	for localPath := range config.readComposeState().Files {
+		if !planned[localPath] {
+			plan.Removed = append(plan.Removed, localPath)
+		}
+	}
+	sort.Strings(plan.Removed)
+
+	for localPath, fileSources := range sources {
+		if len(fileSources) > 1 {
+			plan.Collisions = append(plan.Collisions, PlanCollision{LocalPath: localPath, Sources: fileSources})
+		}
+	}
+	sort.Slice(plan.Collisions, func(i, j int) bool {
+		return plan.Collisions[i].LocalPath < plan.Collisions[j].LocalPath
+	})
+
+	return plan, nil
+}
+
+// plan fetches the origin within its timeout and computes the files it would compose.
+// Commands are not run and the commit information is not looked up, Git origins are cloned shallow
+func (origin *Origin) plan(ctx context.Context) (PlanOrigin, error) {
+
+	origin.planning = true
+	defer func() {
+		origin.planning = false
+	}()
+
+	if origin.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, origin.Timeout)
+		defer cancel()
+	}
+
+	planOrigin := PlanOrigin{URL: origin.URL, Branch: origin.Branch}
+
+	filesystem, err := origin.Fetch(ctx)
+	if err != nil {
+		return planOrigin, errors.Wrap(err, fmt.Sprintf("Error fetching origin %s", origin.URL))
+	}
+	planOrigin.Commit = origin.commit
+
+	err = origin.initPipeline()
+	if err != nil {
+		return planOrigin, err
+	}
+	for _, processor := range origin.pipeline {
+		if command, isCommand := processor.(*commandProcessor); isCommand {
+			planOrigin.Commands = append(planOrigin.Commands, strings.Join(command.Command, " "))
+		}
+	}
+
+	origin.readRepoSettings(filesystem)
+	files, err := origin.getMatchingFiles(ctx, origin.SourceDir, filesystem)
+	if err != nil {
+		return planOrigin, err
+	}
+
+	for i := range files {
+		file := &files[i]
+		file.filesystem = filesystem
+
+		var contentHash string
+		switch file.GetFormat() {
+		case Asciidoc, Markdown:
+			var content []byte
+			content, err = file.processedContent(ctx)
+			hash := sha256.Sum256(content)
+			contentHash = hex.EncodeToString(hash[:])
+		default:
+			contentHash, err = hashRemoteFile(filesystem, file.RemotePath)
+		}
+		file.filesystem = nil
+		if err != nil {
+			return planOrigin, errors.Wrap(err, fmt.Sprintf("Error planning file %s", file.RemotePath))
+		}
+
+		change := PlanAdd
+		if hasContent(file.LocalPath, contentHash) {
+			change = PlanKeep
+		} else if _, err := os.Stat(file.LocalPath); err == nil {
+			change = PlanChange
+			if file.unplanned {
+				change = PlanUnknown
+			}
+		}
+
+		localPath := file.LocalPath
+		if relativePath, err := filepath.Rel(origin.config.HugoWorkingDir, file.LocalPath); err == nil {
+			localPath = filepath.ToSlash(relativePath)
+		}
+		planOrigin.Files = append(planOrigin.Files, PlanFile{
+			RemotePath: file.RemotePath,
+			LocalPath:  localPath,
+			Change:     change,
+		})
+	}
+
+	origin.commits = nil
+	return planOrigin, nil
+}
+
+// count returns the number of files in the plan with the change
+func (plan *Plan) count(change string) int {
+	if change == PlanRemove {
+		return len(plan.Removed)
+	}
+	count := 0
+	for _, origin := range plan.Origins {
+		for _, file := range origin.Files {
+			if file.Change == change {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// Write prints the plan as a diff against the current compose folder
+func (plan *Plan) Write(w io.Writer) {
+	symbols := map[string]string{PlanAdd: "+", PlanChange: "~", PlanKeep: " ", PlanUnknown: "?"}
+
+	for _, origin := range plan.Origins {
+		revision := []string{}
+		if origin.Branch != "" {
+			revision = append(revision, origin.Branch)
+		}
+		if len(origin.Commit) >= 7 {
+			revision = append(revision, origin.Commit[:7])
+		}
+		if len(revision) > 0 {
+			fmt.Fprintf(w, "%s (%s)\n", origin.URL, strings.Join(revision, " @ "))
+		} else {
+			fmt.Fprintln(w, origin.URL)
+		}
+		for _, command := range origin.Commands {
+			fmt.Fprintf(w, "  would run %s\n", command)
+		}
+		for _, file := range origin.Files {
+			fmt.Fprintf(w, "  %s %s -> %s\n", symbols[file.Change], file.RemotePath, file.LocalPath)
+		}
+	}
+
+	if len(plan.Removed) > 0 {
+		fmt.Fprintln(w, "Removed files")
+		for _, localPath := range plan.Removed {
+			fmt.Fprintf(w, "  - %s\n", localPath)
+		}
+	}
+
+	if len(plan.Collisions) > 0 {
+		fmt.Fprintln(w, "Collisions")
+		for _, collision := range plan.Collisions {
+			fmt.Fprintf(w, "  ! %s <- %s\n", collision.LocalPath, strings.Join(collision.Sources, ", "))
+		}
+	}
+
+	fmt.Fprintf(w, "Plan: %d to add, %d to change, %d unchanged, %d unknown, %d to remove, %d collision(s)\n",
+		plan.count(PlanAdd), plan.count(PlanChange), plan.count(PlanKeep), plan.count(PlanUnknown), plan.count(PlanRemove), len(plan.Collisions))
+}
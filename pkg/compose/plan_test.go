@@ -0,0 +1,122 @@
+package compose
+
+// run: go test ./pkg/compose -run TestPlan
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlan(t *testing.T) {
+
+	t.Run("Nothing is written", func(t *testing.T) {
+		dir := writeTestFiles(t, map[string]string{"README.md": "# Readme"})
+		config, _ := getTestConfig(t, Origin{Type: LocalSource, URL: dir, TargetDir: "docs"})
+
+		plan, err := config.Plan(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []PlanFile{{RemotePath: "README.md", LocalPath: "content/docs/README.md", Change: PlanAdd}}, plan.Origins[0].Files)
+		assert.NoDirExists(t, config.HugoWorkingDir)
+	})
+
+	t.Run("Diff against compose folder", func(t *testing.T) {
+		dir := writeTestFiles(t, map[string]string{"README.md": "# Readme", "guide.md": "# Guide", "old.md": "# Old"})
+		config, _ := getTestConfig(t, Origin{Type: LocalSource, URL: dir, TargetDir: "docs"})
+		assert.NoError(t, config.Compose(context.Background()))
+
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "guide.md"), []byte("# Changed Guide"), standardFilemode))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "new.md"), []byte("# New"), standardFilemode))
+		assert.NoError(t, os.Remove(filepath.Join(dir, "old.md")))
+
+		other := writeTestFiles(t, map[string]string{"README.md": "# Other Readme"})
+		config.Origins = append(config.Origins, Origin{Type: LocalSource, URL: other, TargetDir: "docs", config: config})
+		config.Origins[0].Files = nil
+
+		plan, err := config.Plan(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, []PlanFile{
+			{RemotePath: "README.md", LocalPath: "content/docs/README.md", Change: PlanKeep},
+			{RemotePath: "guide.md", LocalPath: "content/docs/guide.md", Change: PlanChange},
+			{RemotePath: "new.md", LocalPath: "content/docs/new.md", Change: PlanAdd},
+		}, plan.Origins[0].Files)
+		assert.Equal(t, []string{"content/docs/old.md"}, plan.Removed)
+		assert.Equal(t, []PlanCollision{{
+			LocalPath: "content/docs/README.md",
+			Sources:   []string{dir + " README.md", other + " README.md"},
+		}}, plan.Collisions)
+		assert.FileExists(t, filepath.Join(config.ContentWorkingDir, "docs/old.md"), "Removed files are kept")
+
+		var out bytes.Buffer
+		plan.Write(&out)
+		assert.Contains(t, out.String(), "  ~ guide.md -> content/docs/guide.md\n")
+		assert.Contains(t, out.String(), "  - content/docs/old.md\n")
+		assert.Contains(t, out.String(), "  ! content/docs/README.md <- ")
+		assert.Contains(t, out.String(), "Plan: 1 to add, 2 to change, 1 unchanged, 0 unknown, 1 to remove, 1 collision(s)\n")
+	})
+
+	t.Run("Commands and commit information are skipped", func(t *testing.T) {
+		dir := createTestGitRepository(t,
+			testCommit{map[string]string{"docs/README.md": "# Readme", "docs/guide.md": "---\ndate: 2020-01-01\n---\n# Guide"}, "Jane", "jane@example.com", "Add docs", time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)},
+		)
+		marker := filepath.Join(dir, "marker")
+		config, _ := getTestConfig(t, Origin{
+			Type:      LocalSource,
+			URL:       filepath.Join(dir, "docs"),
+			TargetDir: "docs",
+			Processors: []ProcessorConfig{
+				{Name: FrontmatterProcessor},
+				{Name: CommandProcessor, Options: ProcessorOptions{"command": []string{"sh", "-c", "touch " + marker + "; cat"}}},
+			},
+		})
+		config.AllowedCommands = []string{"sh"}
+		assert.NoError(t, config.Compose(context.Background()))
+		assert.NoError(t, os.Remove(marker))
+
+		plan, err := config.Plan(context.Background())
+		assert.NoError(t, err)
+		assert.NoFileExists(t, marker)
+		assert.Equal(t, []string{"sh -c touch " + marker + "; cat"}, plan.Origins[0].Commands)
+		assert.Equal(t, []PlanFile{
+			{RemotePath: "README.md", LocalPath: "content/docs/README.md", Change: PlanUnknown},
+			{RemotePath: "guide.md", LocalPath: "content/docs/guide.md", Change: PlanUnknown},
+		}, plan.Origins[0].Files)
+		assert.False(t, config.Origins[0].planning)
+
+		var out bytes.Buffer
+		plan.Write(&out)
+		assert.Contains(t, out.String(), "  would run sh -c touch ")
+		assert.Contains(t, out.String(), "  ? README.md -> content/docs/README.md\n")
+		assert.Contains(t, out.String(), "Plan: 0 to add, 0 to change, 0 unchanged, 2 unknown, 0 to remove, 0 collision(s)\n")
+
+		config.DisableCommitInfo = true
+		assert.NoError(t, config.Compose(context.Background()))
+		plan, err = config.Plan(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, PlanKeep, plan.Origins[0].Files[1].Change, "Unchanged documents are known without commit information")
+	})
+
+	t.Run("Git origins", func(t *testing.T) {
+		dir := createTestGitRepository(t,
+			testCommit{map[string]string{"docs/README.md": "# Readme"}, "Jane", "jane@example.com", "Add docs", time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)},
+			testCommit{map[string]string{"docs/README.md": "# Changed Readme"}, "Jane", "jane@example.com", "Change docs", time.Date(2020, 5, 2, 12, 0, 0, 0, time.UTC)},
+		)
+		config, _ := getTestConfig(t, *NewOrigin(dir, "master", "docs", "docs"))
+
+		plan, err := config.Plan(context.Background())
+		assert.NoError(t, err)
+		assert.Len(t, plan.Origins[0].Commit, 40)
+		assert.Equal(t, []PlanFile{{RemotePath: "docs/README.md", LocalPath: "content/docs/README.md", Change: PlanAdd}}, plan.Origins[0].Files)
+
+		config.Origins[0].Branch = "missing"
+		_, err = config.Plan(context.Background())
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), `branch "missing" not found`)
+	})
+}
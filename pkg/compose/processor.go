@@ -0,0 +1,414 @@
+package compose
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/snipem/monako/pkg/helpers"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Processor transforms the content of a document before it is written to the compose folder
+type Processor interface {
+	// Process returns the transformed content of the file
+	Process(ctx context.Context, file *OriginFile, content []byte) ([]byte, error)
+}
+
+// ProcessorFunc is an adapter to use ordinary functions as Processor
+type ProcessorFunc func(ctx context.Context, file *OriginFile, content []byte) ([]byte, error)
+
+// Process calls f(ctx, file, content)
+func (f ProcessorFunc) Process(ctx context.Context, file *OriginFile, content []byte) ([]byte, error) {
+	return f(ctx, file, content)
+}
+
+// ProcessorFactory returns a new processor for the options given in the config
+type ProcessorFactory func(options ProcessorOptions) (Processor, error)
+
+// ProcessorOptions are the options of a processor as given in the config
+type ProcessorOptions map[string]interface{}
+
+// Decode decodes the options into target, which is a pointer to a struct with yaml tags.
+// Unknown options are returned as error
+func (options ProcessorOptions) Decode(target interface{}) error {
+	if len(options) == 0 {
+		return nil
+	}
+	data, err := yamlv3.Marshal(map[string]interface{}(options))
+	if err != nil {
+		return err
+	}
+	decoder := yamlv3.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	err = decoder.Decode(target)
+	if typeErr, isTypeErr := err.(*yamlv3.TypeError); isTypeErr {
+		// Line numbers and types refer to the marshaled options, not to the config
+		var messages []string
+		for _, message := range typeErr.Errors {
+			message = yamlErrorLine.ReplaceAllString(message, "")
+			messages = append(messages, strings.Split(message, " in type ")[0])
+		}
+		return errors.New(strings.Join(messages, ", "))
+	}
+	return err
+}
+
+// ProcessorConfig selects a processor by name and configures it
+type ProcessorConfig struct {
+	Name    string           `yaml:"name"`
+	Options ProcessorOptions `yaml:"options,omitempty"`
+}
+
+// FrontmatterProcessor adds the commit information to the front matter of documents
+const FrontmatterProcessor = "frontmatter"
+
+// LinksProcessor rewrites relative links of Markdown documents to the URLs of the composed files
+const LinksProcessor = "links"
+
+// ReplaceProcessor replaces strings or regular expressions
+const ReplaceProcessor = "replace"
+
+// HeadingsProcessor shifts the level of all headings
+const HeadingsProcessor = "headings"
+
+// IncludeProcessor replaces {{#include path}} with the content of the file at path
+const IncludeProcessor = "include"
+
+// defaultProcessors are used for origins without configured processors
+var defaultProcessors = []ProcessorConfig{{Name: FrontmatterProcessor}}
+
+var processorsMutex sync.RWMutex
+
+// processors contains the registered processor factories by name
+var processors = map[string]ProcessorFactory{
+	FrontmatterProcessor: newFrontmatterProcessor,
+	LinksProcessor:       newLinksProcessor,
+	ReplaceProcessor:     newReplaceProcessor,
+	HeadingsProcessor:    newHeadingsProcessor,
+	IncludeProcessor:     newIncludeProcessor,
+	CommandProcessor:     newCommandProcessor,
+}
+
+// RegisterProcessor registers the processor factory for the given name. Registering a processor
+// for an existing name replaces it. Processors have to be registered before the config is loaded
+func RegisterProcessor(name string, factory ProcessorFactory) {
+	processorsMutex.Lock()
+	defer processorsMutex.Unlock()
+	processors[name] = factory
+}
+
+// registeredProcessorNames returns the sorted names of all registered processors
+func registeredProcessorNames() []string {
+	processorsMutex.RLock()
+	defer processorsMutex.RUnlock()
+	var names []string
+	for name := range processors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newProcessor returns the processor described by the processor config
+func newProcessor(processorConfig ProcessorConfig) (Processor, error) {
+	processorsMutex.RLock()
+	factory, isRegistered := processors[processorConfig.Name]
+	processorsMutex.RUnlock()
+
+	if !isRegistered {
+		return nil, fmt.Errorf("unknown processor %q, use one of %s", processorConfig.Name, strings.Join(registeredProcessorNames(), ", "))
+	}
+	return factory(processorConfig.Options)
+}
+
+// hasProcessor returns true if the processor configs contain a processor with the name
+func hasProcessor(processorConfigs []ProcessorConfig, name string) bool {
+	for _, processorConfig := range processorConfigs {
+		if processorConfig.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// newPipeline returns the processors for the processor configs in the same order.
+// Command processors are only created for allowed commands
+func newPipeline(processorConfigs []ProcessorConfig, allowedCommands []string) ([]Processor, error) {
+	var pipeline []Processor
+	for _, processorConfig := range processorConfigs {
+		if err := checkCommandAllowed(processorConfig, allowedCommands); err != nil {
+			return nil, err
+		}
+		processor, err := newProcessor(processorConfig)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Error creating processor %s", processorConfig.Name))
+		}
+		pipeline = append(pipeline, processor)
+	}
+	return pipeline, nil
+}
+
+// process runs the content of the file through all processors of the pipeline.
+// Commands are not run while planning
+func process(ctx context.Context, pipeline []Processor, file *OriginFile, content []byte) ([]byte, error) {
+	var err error
+	for _, processor := range pipeline {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if _, isCommand := processor.(*commandProcessor); isCommand && file.parentOrigin != nil && file.parentOrigin.planning {
+			file.unplanned = true
+			continue
+		}
+		content, err = processor.Process(ctx, file, content)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return content, nil
+}
+
+func newFrontmatterProcessor(options ProcessorOptions) (Processor, error) {
+	if err := options.Decode(&struct{}{}); err != nil {
+		return nil, err
+	}
+	return ProcessorFunc(func(ctx context.Context, file *OriginFile, content []byte) ([]byte, error) {
+		file.lookupFirstCommit(ctx, string(content))
+		expanded, err := file.ExpandFrontmatter(string(content))
+		return []byte(expanded), err
+	}), nil
+}
+
+// replaceProcessor replaces From with To. If Regexp is set, From is a regular expression
+// and To can contain references like $1
+type replaceProcessor struct {
+	From   string `yaml:"from"`
+	To     string `yaml:"to"`
+	Regexp bool   `yaml:"regexp"`
+
+	pattern *regexp.Regexp
+}
+
+func newReplaceProcessor(options ProcessorOptions) (Processor, error) {
+	processor := &replaceProcessor{}
+	if err := options.Decode(processor); err != nil {
+		return nil, err
+	}
+	if processor.From == "" {
+		return nil, fmt.Errorf("option from is required")
+	}
+	if processor.Regexp {
+		pattern, err := regexp.Compile(processor.From)
+		if err != nil {
+			return nil, err
+		}
+		processor.pattern = pattern
+	}
+	return processor, nil
+}
+
+// Process replaces all occurrences in content
+func (processor *replaceProcessor) Process(ctx context.Context, file *OriginFile, content []byte) ([]byte, error) {
+	if processor.pattern != nil {
+		return processor.pattern.ReplaceAll(content, []byte(processor.To)), nil
+	}
+	return bytes.ReplaceAll(content, []byte(processor.From), []byte(processor.To)), nil
+}
+
+// headingsProcessor shifts the level of Markdown and Asciidoc headings by Shift,
+// headings within code blocks are kept
+type headingsProcessor struct {
+	Shift int `yaml:"shift"`
+}
+
+func newHeadingsProcessor(options ProcessorOptions) (Processor, error) {
+	processor := &headingsProcessor{}
+	if err := options.Decode(processor); err != nil {
+		return nil, err
+	}
+	return processor, nil
+}
+
+var markdownHeading = regexp.MustCompile(`^(#{1,6})(\s.*)?$`)
+var asciidocHeading = regexp.MustCompile(`^(={1,6})(\s.*)$`)
+
+// Process shifts all headings of content, levels are kept between 1 and 6
+func (processor *headingsProcessor) Process(ctx context.Context, file *OriginFile, content []byte) ([]byte, error) {
+
+	heading, marker, fences := markdownHeading, "#", []string{"```", "~~~"}
+	if file.GetFormat() == Asciidoc {
+		heading, marker, fences = asciidocHeading, "=", []string{"----", "...."}
+	}
+
+	lines := strings.Split(string(content), "\n")
+	fence := ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		for _, f := range fences {
+			if strings.HasPrefix(trimmed, f) {
+				fence = f
+			}
+		}
+		if fence != "" {
+			continue
+		}
+
+		groups := heading.FindStringSubmatch(line)
+		if groups == nil {
+			continue
+		}
+		level := len(groups[1]) + processor.Shift
+		if level < 1 {
+			level = 1
+		}
+		if level > 6 {
+			level = 6
+		}
+		lines[i] = strings.Repeat(marker, level) + groups[2]
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// markdownLink matches the target of inline Markdown links and images followed by the end of the link or a title
+var markdownLink = regexp.MustCompile(`(\]\()([^)\s]+)(\)|\s+["'(])`)
+
+func newLinksProcessor(options ProcessorOptions) (Processor, error) {
+	if err := options.Decode(&struct{}{}); err != nil {
+		return nil, err
+	}
+	return ProcessorFunc(rewriteLinks), nil
+}
+
+// rewriteLinks rewrites relative links in Markdown documents to the URLs Hugo uses for the
+// composed files. Links to files outside of the docdir of the origin are kept
+func rewriteLinks(ctx context.Context, file *OriginFile, content []byte) ([]byte, error) {
+	if file.GetFormat() != Markdown {
+		return content, nil
+	}
+
+	origin := file.parentOrigin
+	pageURL := hugoURL(file.contentPath())
+
+	return markdownLink.ReplaceAllFunc(content, func(match []byte) []byte {
+		groups := markdownLink.FindSubmatch(match)
+		target := string(groups[2])
+
+		if strings.Contains(target, ":") || strings.HasPrefix(target, "#") || strings.HasPrefix(target, "/") {
+			return match
+		}
+
+		fragment := ""
+		if i := strings.IndexAny(target, "#?"); i >= 0 {
+			target, fragment = target[:i], target[i:]
+		}
+
+		remotePath := path.Join(path.Dir(file.RemotePath), target)
+		sourceDir := path.Clean(origin.SourceDir)
+		if sourceDir != "." && remotePath != sourceDir && !strings.HasPrefix(remotePath, sourceDir+"/") {
+			return match
+		}
+		if sourceDir == "." && strings.HasPrefix(remotePath, "../") {
+			return match
+		}
+
+		targetFile := OriginFile{RemotePath: remotePath, parentOrigin: origin}
+		targetURL := hugoURL(targetFile.contentPath())
+
+		relativeURL, err := filepath.Rel(filepath.FromSlash(pageURL), filepath.FromSlash(targetURL))
+		if err != nil {
+			return match
+		}
+		relativeURL = filepath.ToSlash(relativeURL)
+		if strings.HasSuffix(targetURL, "/") {
+			relativeURL += "/"
+		}
+
+		return []byte(string(groups[1]) + relativeURL + fragment + string(groups[3]))
+	}), nil
+}
+
+// contentPath returns the path of the composed file relative to the content folder
+func (file *OriginFile) contentPath() string {
+	if config := file.parentOrigin.config; file.LocalPath != "" && config != nil {
+		// The local path differs from the remote path for renamed files
+		if contentPath, err := filepath.Rel(config.ContentWorkingDir, file.LocalPath); err == nil && !strings.HasPrefix(contentPath, "..") {
+			return filepath.ToSlash(contentPath)
+		}
+	}
+	return path.Join(filepath.ToSlash(file.parentOrigin.TargetDir), strings.TrimPrefix(file.RemotePath, file.parentOrigin.SourceDir))
+}
+
+// hugoURL returns the URL path Hugo renders a content file to. Documents become pages,
+// index and _index documents represent their directory
+func hugoURL(contentPath string) string {
+	contentPath = "/" + strings.Trim(path.Clean("/"+contentPath), "/")
+	if !helpers.IsMarkdown(contentPath) && !helpers.IsAsciidoc(contentPath) {
+		return contentPath
+	}
+
+	dir, name := path.Split(strings.TrimSuffix(contentPath, path.Ext(contentPath)))
+	urlPath := path.Join(dir, name)
+	if name == "index" || name == "_index" {
+		urlPath = dir
+	}
+	urlPath = strings.ToLower(strings.ReplaceAll(urlPath, " ", "-"))
+	return strings.TrimSuffix(urlPath, "/") + "/"
+}
+
+// includeDirective matches {{#include path}} on its own line
+var includeDirective = regexp.MustCompile(`(?m)^[ \t]*\{\{#include\s+([^}\s]+)\s*\}\}[ \t]*$`)
+
+// maxIncludeDepth limits nested includes
+const maxIncludeDepth = 10
+
+func newIncludeProcessor(options ProcessorOptions) (Processor, error) {
+	if err := options.Decode(&struct{}{}); err != nil {
+		return nil, err
+	}
+	return ProcessorFunc(func(ctx context.Context, file *OriginFile, content []byte) ([]byte, error) {
+		return resolveIncludes(file, file.RemotePath, content, 0)
+	}), nil
+}
+
+// resolveIncludes replaces all include directives in content, which has been read from remotePath,
+// with the content of the included files. Paths are relative to the including file
+func resolveIncludes(file *OriginFile, remotePath string, content []byte, depth int) ([]byte, error) {
+	if depth > maxIncludeDepth {
+		return nil, fmt.Errorf("includes of %s are nested deeper than %d levels", file.RemotePath, maxIncludeDepth)
+	}
+
+	var includeErr error
+	resolved := includeDirective.ReplaceAllFunc(content, func(match []byte) []byte {
+		if includeErr != nil {
+			return match
+		}
+		includePath := path.Join(path.Dir(remotePath), string(includeDirective.FindSubmatch(match)[1]))
+
+		included, err := file.ReadRemoteFile(includePath)
+		if err != nil {
+			includeErr = errors.Wrap(err, fmt.Sprintf("Error including %s in %s", includePath, remotePath))
+			return match
+		}
+		included, err = resolveIncludes(file, includePath, included, depth+1)
+		if err != nil {
+			includeErr = err
+			return match
+		}
+		return bytes.TrimRight(included, "\n")
+	})
+	return resolved, includeErr
+}
@@ -0,0 +1,216 @@
+package compose
+
+// run: go test ./pkg/compose -run TestProcess
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// runProcessor runs the processor on the file at remotePath of the filesystem
+func runProcessor(t *testing.T, processorConfig ProcessorConfig, filesystem billy.Filesystem, remotePath string) string {
+	processor, err := newProcessor(processorConfig)
+	assert.NoError(t, err)
+
+	file := &OriginFile{
+		RemotePath:   remotePath,
+		parentOrigin: NewOrigin("https://github.com/snipem/monako-test.git", "master", "docs", "docs/test"),
+		filesystem:   filesystem,
+	}
+	content, err := file.ReadRemoteFile(remotePath)
+	assert.NoError(t, err)
+
+	processed, err := processor.Process(context.Background(), file, content)
+	assert.NoError(t, err)
+	return string(processed)
+}
+
+func TestProcessReplace(t *testing.T) {
+	filesystem := newTestFilesystem(t, map[string]string{"docs/README.md": "See JIRA-123 and JIRA-7 at old.example.com"})
+
+	assert.Equal(t, "See JIRA-123 and JIRA-7 at new.example.com", runProcessor(t, ProcessorConfig{
+		Name:    ReplaceProcessor,
+		Options: ProcessorOptions{"from": "old.example.com", "to": "new.example.com"},
+	}, filesystem, "docs/README.md"))
+
+	assert.Equal(t, "See [JIRA-123](https://jira/JIRA-123) and [JIRA-7](https://jira/JIRA-7) at old.example.com", runProcessor(t, ProcessorConfig{
+		Name:    ReplaceProcessor,
+		Options: ProcessorOptions{"from": `(JIRA-\d+)`, "to": "[$1](https://jira/$1)", "regexp": true},
+	}, filesystem, "docs/README.md"))
+}
+
+func TestProcessHeadings(t *testing.T) {
+	filesystem := newTestFilesystem(t, map[string]string{
+		"docs/README.md":  "# Title\n\n```bash\n# comment\n```\n\n###### Deep\n#hashtag",
+		"docs/guide.adoc": "= Title\n\n----\n= listing\n----\n\n== Section",
+	})
+
+	assert.Equal(t, "## Title\n\n```bash\n# comment\n```\n\n###### Deep\n#hashtag", runProcessor(t, ProcessorConfig{
+		Name:    HeadingsProcessor,
+		Options: ProcessorOptions{"shift": 1},
+	}, filesystem, "docs/README.md"))
+
+	assert.Equal(t, "= Title\n\n----\n= listing\n----\n\n= Section", runProcessor(t, ProcessorConfig{
+		Name:    HeadingsProcessor,
+		Options: ProcessorOptions{"shift": -1},
+	}, filesystem, "docs/guide.adoc"))
+}
+
+func TestProcessLinks(t *testing.T) {
+	filesystem := newTestFilesystem(t, map[string]string{
+		"docs/guide/setup.md": strings.Join([]string{
+			"[Readme](../README.md)",
+			"[Other](other.md#install)",
+			"[Index](_index.md)",
+			"![Image](images/Screen Shot.png)",
+			"![Image](images/shot.png)",
+			"[Outside](../../CHANGELOG.md)",
+			"[External](https://example.com/page.md)",
+			"[Anchor](#anchor)",
+			"[Absolute](/docs/page/)",
+		}, "\n"),
+	})
+
+	assert.Equal(t, strings.Join([]string{
+		"[Readme](../../readme/)",
+		"[Other](../other/#install)",
+		"[Index](../)",
+		"![Image](images/Screen Shot.png)",
+		"![Image](../images/shot.png)",
+		"[Outside](../../CHANGELOG.md)",
+		"[External](https://example.com/page.md)",
+		"[Anchor](#anchor)",
+		"[Absolute](/docs/page/)",
+	}, "\n"), runProcessor(t, ProcessorConfig{Name: LinksProcessor}, filesystem, "docs/guide/setup.md"))
+}
+
+func TestHugoURL(t *testing.T) {
+	assert.Equal(t, "/docs/test/readme/", hugoURL("docs/test/README.md"))
+	assert.Equal(t, "/docs/test/", hugoURL("docs/test/_index.md"))
+	assert.Equal(t, "/docs/test/", hugoURL("docs/test/index.adoc"))
+	assert.Equal(t, "/docs/test/my-page/", hugoURL("docs/test/My Page.md"))
+	assert.Equal(t, "/docs/test/Image.PNG", hugoURL("docs/test/Image.PNG"))
+}
+
+func TestProcessInclude(t *testing.T) {
+	filesystem := newTestFilesystem(t, map[string]string{
+		"docs/README.md":           "# Readme\n\n{{#include snippets/install.md}}\n\nDone",
+		"docs/snippets/install.md": "Install with:\n  {{#include ../../LICENSE.md }}\n",
+		"LICENSE.md":               "MIT",
+		"docs/missing.md":          "{{#include not-existing.md}}",
+		"docs/cycle.md":            "{{#include cycle.md}}",
+	})
+
+	assert.Equal(t, "# Readme\n\nInstall with:\nMIT\n\nDone", runProcessor(t, ProcessorConfig{Name: IncludeProcessor}, filesystem, "docs/README.md"))
+
+	processor, err := newProcessor(ProcessorConfig{Name: IncludeProcessor})
+	assert.NoError(t, err)
+	for _, remotePath := range []string{"docs/missing.md", "docs/cycle.md"} {
+		file := &OriginFile{RemotePath: remotePath, filesystem: filesystem}
+		content, _ := file.ReadRemoteFile(remotePath)
+		_, err = processor.Process(context.Background(), file, content)
+		assert.Error(t, err, remotePath)
+	}
+}
+
+func TestProcessPipeline(t *testing.T) {
+
+	RegisterProcessor("upper", func(options ProcessorOptions) (Processor, error) {
+		return ProcessorFunc(func(ctx context.Context, file *OriginFile, content []byte) ([]byte, error) {
+			return []byte(strings.ToUpper(string(content))), nil
+		}), nil
+	})
+	defer func() {
+		processorsMutex.Lock()
+		delete(processors, "upper")
+		processorsMutex.Unlock()
+	}()
+
+	config, _ := getTestConfig(t, Origin{
+		URL:           "https://github.com/snipem/monako-test.git",
+		SourceDir:     "docs",
+		TargetDir:     "docs/test",
+		FileWhitelist: []string{".md"},
+		Processors: []ProcessorConfig{
+			{Name: ReplaceProcessor, Options: ProcessorOptions{"from": "World", "to": "Monako"}},
+			{Name: "upper"},
+			{Name: HeadingsProcessor, Options: ProcessorOptions{"shift": 1}},
+		},
+	})
+	filesystem := newTestFilesystem(t, map[string]string{"docs/README.md": "# Hello World"})
+
+	err := config.Origins[0].ComposeDir(context.Background(), filesystem)
+	assert.NoError(t, err)
+
+	content, err := ioutil.ReadFile(filepath.Join(config.ContentWorkingDir, "docs/test/README.md"))
+	assert.NoError(t, err)
+	assert.Equal(t, "## HELLO MONAKO", string(content))
+
+	t.Run("Front matter is added", func(t *testing.T) {
+		dir := createTestGitRepository(t,
+			testCommit{map[string]string{"docs/README.md": "# Hello World"}, "Jane", "jane@example.com", "Add docs", time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)},
+		)
+		config, _ := getTestConfig(t, Origin{
+			Type:      LocalSource,
+			URL:       filepath.Join(dir, "docs"),
+			TargetDir: "docs",
+			Processors: []ProcessorConfig{
+				{Name: HeadingsProcessor, Options: ProcessorOptions{"shift": 1}},
+				{Name: ReplaceProcessor, Options: ProcessorOptions{"from": "Jane", "to": "John"}},
+			},
+		})
+		assert.NoError(t, config.Compose(context.Background()))
+
+		content, err := ioutil.ReadFile(filepath.Join(config.ContentWorkingDir, "docs/README.md"))
+		assert.NoError(t, err)
+		assert.Contains(t, string(content), "MonakoGitRemotePath: README.md\n")
+		assert.Contains(t, string(content), "MonakoGitLastCommitAuthor: Jane\n", "Processors don't change the added front matter")
+		assert.Contains(t, string(content), "## Hello World")
+	})
+}
+
+func TestValidateProcessors(t *testing.T) {
+	configFile := writeTestConfig(t, `
+processors:
+  - name: frontmatter
+  - name: rewrite
+origins:
+  - src: https://github.com/snipem/monako-test.git
+    branch: master
+    targetdir: docs/test
+    processors:
+      - name: replace
+        options:
+          to: nothing
+      - name: headings
+        options:
+          shift: 1
+          unknown: true
+`)
+	_, err := LoadConfig(configFile, "")
+	assert.Error(t, err)
+	errs := err.(ConfigErrors)
+
+	var fields []string
+	var lines []int
+	for _, e := range errs {
+		fields = append(fields, e.Field)
+		lines = append(lines, e.Line)
+	}
+	assert.Equal(t, []string{
+		"processors[1].name",
+		"origins[0].processors[0].options",
+		"origins[0].processors[1].options",
+	}, fields)
+	assert.Equal(t, []int{4, 11, 14}, lines)
+	assert.Contains(t, errs[0].Message, "frontmatter, headings, include, links, replace")
+	assert.Contains(t, errs[1].Message, "option from is required")
+	assert.Equal(t, "field unknown not found", errs[2].Message)
+}
@@ -0,0 +1,263 @@
+package compose
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Built-in Git hosting providers
+const (
+	// GitHubProvider creates links for GitHub and GitHub Enterprise
+	GitHubProvider = "github"
+	// GitLabProvider creates links for GitLab
+	GitLabProvider = "gitlab"
+	// GiteaProvider creates links for Gitea, Forgejo and Gogs
+	GiteaProvider = "gitea"
+	// BitbucketProvider creates links for Bitbucket Cloud
+	BitbucketProvider = "bitbucket"
+	// BitbucketServerProvider creates links for Bitbucket Server and Data Center
+	BitbucketServerProvider = "bitbucket-server"
+	// AzureDevOpsProvider creates links for Azure DevOps
+	AzureDevOpsProvider = "azure-devops"
+)
+
+// GitProvider creates links to the web interface of a Git hosting service
+type GitProvider interface {
+	// FileURL returns the link to the file at remotePath on the branch of the repository
+	FileURL(repository *url.URL, branch string, remotePath string) string
+	// EditURL returns the link for editing the file at remotePath on the branch of the repository,
+	// empty if the service has no such link
+	EditURL(repository *url.URL, branch string, remotePath string) string
+	// CommitURL returns the link to the commit of the repository
+	CommitURL(repository *url.URL, commit string) string
+}
+
+// pathProvider is a GitProvider for services with links of the form
+// <repository>/<filePath>/<branch>/<remotePath> and <repository>/<commitPath>/<commit>
+type pathProvider struct {
+	filePath   string
+	commitPath string
+	// editPath and editQuery form edit links like <repository>/<editPath>/<branch>/<remotePath>?<editQuery>
+	editPath  string
+	editQuery string
+}
+
+func (provider pathProvider) FileURL(repository *url.URL, branch string, remotePath string) string {
+	u := *repository
+	u.Path = path.Join(u.Path, provider.filePath, branch, remotePath)
+	return u.String()
+}
+
+func (provider pathProvider) EditURL(repository *url.URL, branch string, remotePath string) string {
+	u := *repository
+	u.Path = path.Join(u.Path, provider.editPath, branch, remotePath)
+	u.RawQuery = provider.editQuery
+	return u.String()
+}
+
+func (provider pathProvider) CommitURL(repository *url.URL, commit string) string {
+	u := *repository
+	u.Path = path.Join(u.Path, provider.commitPath, commit)
+	return u.String()
+}
+
+// bitbucketServerRepository matches the path of clone URLs of Bitbucket Server
+var bitbucketServerRepository = regexp.MustCompile(`^(.*?)/(?:scm/)?([^/]+)/([^/]+)$`)
+
+// bitbucketServerProvider creates links for Bitbucket Server, where repositories are cloned
+// from <host>/scm/<project>/<repository>
+type bitbucketServerProvider struct{}
+
+// repositoryURL returns the web URL of the repository
+func (bitbucketServerProvider) repositoryURL(repository *url.URL) *url.URL {
+	u := *repository
+	if match := bitbucketServerRepository.FindStringSubmatch(u.Path); match != nil {
+		u.Path = path.Join("/", match[1], "projects", match[2], "repos", match[3])
+	}
+	return &u
+}
+
+func (provider bitbucketServerProvider) FileURL(repository *url.URL, branch string, remotePath string) string {
+	u := provider.repositoryURL(repository)
+	u.Path = path.Join(u.Path, "browse", remotePath)
+	u.RawQuery = url.Values{"at": {"refs/heads/" + branch}}.Encode()
+	return u.String()
+}
+
+// EditURL returns the link to the file, Bitbucket Server has no direct links for editing
+func (provider bitbucketServerProvider) EditURL(repository *url.URL, branch string, remotePath string) string {
+	return provider.FileURL(repository, branch, remotePath)
+}
+
+func (provider bitbucketServerProvider) CommitURL(repository *url.URL, commit string) string {
+	u := provider.repositoryURL(repository)
+	u.Path = path.Join(u.Path, "commits", commit)
+	return u.String()
+}
+
+// azureDevOpsProvider creates links for Azure DevOps, where repositories are cloned
+// from dev.azure.com/<organization>/<project>/_git/<repository>
+type azureDevOpsProvider struct{}
+
+// repositoryURL returns the web URL of the repository
+func (azureDevOpsProvider) repositoryURL(repository *url.URL) *url.URL {
+	u := *repository
+	// SSH URLs are ssh.dev.azure.com:v3/<organization>/<project>/<repository>
+	if u.Host == "ssh.dev.azure.com" {
+		elements := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(elements) == 4 && elements[0] == "v3" {
+			u.Host = "dev.azure.com"
+			u.Path = path.Join("/", elements[1], elements[2], "_git", elements[3])
+		}
+	}
+	return &u
+}
+
+func (provider azureDevOpsProvider) FileURL(repository *url.URL, branch string, remotePath string) string {
+	u := provider.repositoryURL(repository)
+	u.RawQuery = url.Values{"path": {path.Join("/", remotePath)}, "version": {"GB" + branch}}.Encode()
+	return u.String()
+}
+
+// EditURL returns the link to the file, Azure DevOps has no direct links for editing
+func (provider azureDevOpsProvider) EditURL(repository *url.URL, branch string, remotePath string) string {
+	return provider.FileURL(repository, branch, remotePath)
+}
+
+func (provider azureDevOpsProvider) CommitURL(repository *url.URL, commit string) string {
+	u := provider.repositoryURL(repository)
+	u.Path = path.Join(u.Path, "commit", commit)
+	return u.String()
+}
+
+var gitProvidersMutex sync.RWMutex
+
+// gitProviders contains the registered providers by name
+var gitProviders = map[string]GitProvider{
+	GitHubProvider:          pathProvider{filePath: "blob", commitPath: "commit", editPath: "edit"},
+	GitLabProvider:          pathProvider{filePath: "-/blob", commitPath: "-/commit", editPath: "-/edit"},
+	GiteaProvider:           pathProvider{filePath: "src/branch", commitPath: "commit", editPath: "_edit"},
+	BitbucketProvider:       pathProvider{filePath: "src", commitPath: "commits", editPath: "src", editQuery: "mode=edit"},
+	BitbucketServerProvider: bitbucketServerProvider{},
+	AzureDevOpsProvider:     azureDevOpsProvider{},
+}
+
+// defaultGitProviderHosts maps the hosts of public services to their provider
+var defaultGitProviderHosts = map[string]string{
+	"github.com":        GitHubProvider,
+	"gitlab.com":        GitLabProvider,
+	"gitea.com":         GiteaProvider,
+	"codeberg.org":      GiteaProvider,
+	"bitbucket.org":     BitbucketProvider,
+	"dev.azure.com":     AzureDevOpsProvider,
+	"ssh.dev.azure.com": AzureDevOpsProvider,
+}
+
+// RegisterGitProvider registers a provider for creating web links under the given name.
+// Hosts are mapped to it with gitProviders in the config. A provider registered under
+// the name of a built-in provider replaces it
+func RegisterGitProvider(name string, provider GitProvider) {
+	gitProvidersMutex.Lock()
+	defer gitProvidersMutex.Unlock()
+	gitProviders[name] = provider
+}
+
+// getGitProvider returns the provider registered under the name
+func getGitProvider(name string) (GitProvider, bool) {
+	gitProvidersMutex.RLock()
+	defer gitProvidersMutex.RUnlock()
+	provider, isRegistered := gitProviders[name]
+	return provider, isRegistered
+}
+
+// registeredGitProviderNames returns the sorted names of all registered providers
+func registeredGitProviderNames() []string {
+	gitProvidersMutex.RLock()
+	defer gitProvidersMutex.RUnlock()
+	var names []string
+	for name := range gitProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// providerNameForHost returns the name of the provider for the host. Configured hosts
+// take precedence over the public services, unknown hosts are guessed by their name
+func providerNameForHost(host string, hosts map[string]string) string {
+	host = strings.ToLower(host)
+	if name, found := hosts[host]; found {
+		return name
+	}
+	if name, found := defaultGitProviderHosts[host]; found {
+		return name
+	}
+
+	switch {
+	case strings.HasSuffix(host, ".visualstudio.com"):
+		return AzureDevOpsProvider
+	case strings.Contains(host, "bitbucket"):
+		return BitbucketProvider
+	case strings.Contains(host, "gitlab"):
+		return GitLabProvider
+	case strings.Contains(host, "gitea"), strings.Contains(host, "forgejo"):
+		return GiteaProvider
+	}
+	return GitHubProvider
+}
+
+// scpLikeURL matches SSH URLs in the short scp-like syntax, like git@github.com:snipem/monako.git
+var scpLikeURL = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):(.+)$`)
+
+// repositoryWebURL returns the HTTPS URL of the web interface of a repository cloned from gitURL.
+// SSH URLs are translated to HTTPS, credentials are removed. Returns nil for local paths
+func repositoryWebURL(gitURL string) *url.URL {
+	gitURL = strings.TrimSuffix(strings.TrimSuffix(gitURL, "/"), ".git")
+
+	// Single letter hosts are drive letters of Windows paths
+	if match := scpLikeURL.FindStringSubmatch(gitURL); match != nil && len(match[1]) > 1 && !strings.Contains(gitURL, "://") {
+		gitURL = "https://" + match[1] + "/" + strings.TrimPrefix(match[2], "/")
+	}
+
+	u, err := url.Parse(gitURL)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+	case "ssh", "git", "git+ssh", "ssh+git":
+		// The web interface doesn't use the port of the SSH server
+		u.Scheme = "https"
+		u.Host = u.Hostname()
+	default:
+		return nil
+	}
+	u.User = nil
+	return u
+}
+
+// gitProviderHosts returns the hosts mapped to providers in the config of the origin
+func (origin *Origin) gitProviderHosts() map[string]string {
+	if origin.config == nil {
+		return nil
+	}
+	return origin.config.GitProviders
+}
+
+// webLink resolves the repository and provider for gitURL and returns the link created by link
+func webLink(gitURL string, hosts map[string]string, link func(provider GitProvider, repository *url.URL) string) string {
+	repository := repositoryWebURL(gitURL)
+	if repository == nil {
+		return ""
+	}
+	provider, isRegistered := getGitProvider(providerNameForHost(repository.Hostname(), hosts))
+	if !isRegistered {
+		return ""
+	}
+	return link(provider, repository)
+}
@@ -0,0 +1,123 @@
+package compose
+
+// run: go test ./pkg/compose -run TestGitProvider
+
+import (
+	"net/url"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGitProviders(t *testing.T) {
+
+	hosts := map[string]string{
+		"git.example.com":       GitLabProvider,
+		"code.example.com":      GiteaProvider,
+		"bitbucket.example.com": BitbucketServerProvider,
+	}
+
+	for _, tc := range []struct {
+		gitURL, file, commit string
+	}{
+		{"https://git.example.com/group/sub/handbook.git",
+			"https://git.example.com/group/sub/handbook/-/blob/main/docs/README.md",
+			"https://git.example.com/group/sub/handbook/-/commit/abc123"},
+		{"https://code.example.com/team/handbook.git",
+			"https://code.example.com/team/handbook/src/branch/main/docs/README.md",
+			"https://code.example.com/team/handbook/commit/abc123"},
+		{"https://codeberg.org/team/handbook.git",
+			"https://codeberg.org/team/handbook/src/branch/main/docs/README.md",
+			"https://codeberg.org/team/handbook/commit/abc123"},
+		{"https://bitbucket.example.com/scm/DOCS/handbook.git",
+			"https://bitbucket.example.com/projects/DOCS/repos/handbook/browse/docs/README.md?at=refs%2Fheads%2Fmain",
+			"https://bitbucket.example.com/projects/DOCS/repos/handbook/commits/abc123"},
+		{"ssh://git@bitbucket.example.com:7999/docs/handbook.git",
+			"https://bitbucket.example.com/projects/docs/repos/handbook/browse/docs/README.md?at=refs%2Fheads%2Fmain",
+			"https://bitbucket.example.com/projects/docs/repos/handbook/commits/abc123"},
+		{"https://org@dev.azure.com/org/project/_git/handbook",
+			"https://dev.azure.com/org/project/_git/handbook?path=%2Fdocs%2FREADME.md&version=GBmain",
+			"https://dev.azure.com/org/project/_git/handbook/commit/abc123"},
+		{"git@ssh.dev.azure.com:v3/org/project/handbook",
+			"https://dev.azure.com/org/project/_git/handbook?path=%2Fdocs%2FREADME.md&version=GBmain",
+			"https://dev.azure.com/org/project/_git/handbook/commit/abc123"},
+		{"git@gitlab.internal.example.com:group/handbook.git",
+			"https://gitlab.internal.example.com/group/handbook/-/blob/main/docs/README.md",
+			"https://gitlab.internal.example.com/group/handbook/-/commit/abc123"},
+		{"ssh://git@github.com/snipem/monako.git",
+			"https://github.com/snipem/monako/blob/main/docs/README.md",
+			"https://github.com/snipem/monako/commit/abc123"},
+		{"C:/docs/handbook", "", ""},
+		{"../handbook", "", ""},
+	} {
+		t.Run(tc.gitURL, func(t *testing.T) {
+			assert.Equal(t, tc.file, getWebLinkForFileInGit(tc.gitURL, "main", "docs/README.md", hosts))
+			assert.Equal(t, tc.commit, getWebLinkForGitCommit(tc.gitURL, "abc123", hosts))
+		})
+	}
+
+	for gitURL, expected := range map[string]string{
+		"https://github.com/snipem/monako.git":                "https://github.com/snipem/monako/edit/main/docs/README.md",
+		"https://git.example.com/group/handbook.git":          "https://git.example.com/group/handbook/-/edit/main/docs/README.md",
+		"https://code.example.com/team/handbook.git":          "https://code.example.com/team/handbook/_edit/main/docs/README.md",
+		"git@bitbucket.org:team/handbook.git":                 "https://bitbucket.org/team/handbook/src/main/docs/README.md?mode=edit",
+		"https://bitbucket.example.com/scm/DOCS/handbook.git": "https://bitbucket.example.com/projects/DOCS/repos/handbook/browse/docs/README.md?at=refs%2Fheads%2Fmain",
+		"https://dev.azure.com/org/project/_git/handbook":     "https://dev.azure.com/org/project/_git/handbook?path=%2Fdocs%2FREADME.md&version=GBmain",
+		"/local/handbook": "",
+	} {
+		t.Run("Edit "+gitURL, func(t *testing.T) {
+			assert.Equal(t, expected, getEditLinkForFileInGit(gitURL, "main", "docs/README.md", hosts))
+		})
+	}
+
+	t.Run("Registered provider", func(t *testing.T) {
+		RegisterGitProvider("cgit", testCgitProvider{})
+		defer func() {
+			gitProvidersMutex.Lock()
+			delete(gitProviders, "cgit")
+			gitProvidersMutex.Unlock()
+		}()
+
+		assert.Equal(t, "https://git.example.org/handbook/tree/docs/README.md?h=main",
+			getWebLinkForFileInGit("https://git.example.org/handbook", "main", "docs/README.md", map[string]string{"git.example.org": "cgit"}))
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		configFile := writeTestConfig(t, `
+gitProviders:
+  git.example.com: gitlab
+  code.example.com: gogs
+origins:
+  - src: https://github.com/snipem/monako-test.git
+    branch: master
+`)
+		_, err := LoadConfig(configFile, "")
+		assert.Error(t, err)
+		errs := err.(ConfigErrors)
+		assert.Len(t, errs, 1)
+		assert.Equal(t, "gitProviders.code.example.com", errs[0].Field)
+		assert.Equal(t, 4, errs[0].Line)
+		assert.Contains(t, errs[0].Message, "unknown provider, use one of azure-devops, bitbucket, bitbucket-server, gitea, github, gitlab")
+	})
+}
+
+type testCgitProvider struct{}
+
+func (testCgitProvider) FileURL(repository *url.URL, branch string, remotePath string) string {
+	u := *repository
+	u.Path = path.Join(u.Path, "tree", remotePath)
+	u.RawQuery = "h=" + branch
+	return u.String()
+}
+
+func (testCgitProvider) EditURL(repository *url.URL, branch string, remotePath string) string {
+	return ""
+}
+
+func (testCgitProvider) CommitURL(repository *url.URL, commit string) string {
+	u := *repository
+	u.Path = path.Join(u.Path, "commit")
+	u.RawQuery = "id=" + commit
+	return u.String()
+}
@@ -0,0 +1,281 @@
+package compose
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5/plumbing/format/gitattributes"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+	log "github.com/sirupsen/logrus"
+	"github.com/snipem/monako/pkg/helpers"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// monakoIgnoreFileName is the file in the docdir of an origin listing files not to compose, in gitignore syntax
+const monakoIgnoreFileName = ".monakoignore"
+
+// gitattributesFileName is the file in the docdir of an origin, files with the export-ignore attribute are not composed
+const gitattributesFileName = ".gitattributes"
+
+// repoConfigFileName is the config fragment in the docdir of an origin
+const repoConfigFileName = ".monako.yaml"
+
+// Settings origins can change with the files in their docdir
+const (
+	// RepoSettingExclude allows .monakoignore, export-ignore in .gitattributes and exclude in .monako.yaml
+	RepoSettingExclude = "exclude"
+	// RepoSettingFrontmatter allows front matter defaults and rules in .monako.yaml
+	RepoSettingFrontmatter = "frontmatter"
+	// RepoSettingMenu allows menu hints in .monako.yaml
+	RepoSettingMenu = "menu"
+)
+
+// repoSettingNames are the names of all settings origins can change
+var repoSettingNames = []string{RepoSettingExclude, RepoSettingFrontmatter, RepoSettingMenu}
+
+// isRepoSetting returns true if name is a setting origins can change
+func isRepoSetting(name string) bool {
+	for _, setting := range repoSettingNames {
+		if name == setting {
+			return true
+		}
+	}
+	return false
+}
+
+// RepoSettingsPolicy restricts the settings origins read from the files in their docdir
+type RepoSettingsPolicy struct {
+	// Disable ignores the files in the docdir
+	Disable bool `yaml:"disable,omitempty"`
+	// Allow lists the settings origins can change: exclude, frontmatter and menu. All if empty
+	Allow []string `yaml:"allow,omitempty"`
+}
+
+// RepoConfig is the .monako.yaml fragment in the docdir of an origin
+type RepoConfig struct {
+	// Exclude lists further files not to compose, in gitignore syntax
+	Exclude []string `yaml:"exclude,omitempty"`
+	// Frontmatter adds defaults and rules, other front matter settings are ignored
+	Frontmatter *FrontmatterConfig `yaml:"frontmatter,omitempty"`
+	// Menu is added to the front matter of the index document of the docdir
+	Menu *MenuHints `yaml:"menu,omitempty"`
+}
+
+// MenuHints change how the docdir of an origin is shown in the menu
+type MenuHints struct {
+	Title    string `yaml:"title,omitempty"`
+	Weight   *int   `yaml:"weight,omitempty"`
+	Collapse bool   `yaml:"collapse,omitempty"`
+	Hidden   bool   `yaml:"hidden,omitempty"`
+}
+
+// repoSettings are the settings an origin read from the files in its docdir
+type repoSettings struct {
+	ignore      gitignore.Matcher
+	attributes  gitattributes.Matcher
+	frontmatter *FrontmatterConfig
+}
+
+// repoSettingsPolicy returns the policy for the origin, the policy of the origin replaces the one of the config
+func (origin *Origin) repoSettingsPolicy() RepoSettingsPolicy {
+	if origin.RepoSettings != nil {
+		return *origin.RepoSettings
+	}
+	if origin.config == nil {
+		return RepoSettingsPolicy{}
+	}
+	return origin.config.RepoSettings
+}
+
+// allowsRepoSetting returns true if the origin can change the setting with the files in its docdir
+func (origin *Origin) allowsRepoSetting(name string) bool {
+	policy := origin.repoSettingsPolicy()
+	if policy.Disable {
+		return false
+	}
+	if len(policy.Allow) == 0 {
+		return true
+	}
+	for _, allowed := range policy.Allow {
+		if allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// readRepoSettings reads the .monakoignore, .gitattributes and .monako.yaml in the docdir of the origin.
+// Settings not allowed by the policy are ignored, invalid files are skipped with a warning
+func (origin *Origin) readRepoSettings(filesystem billy.Filesystem) {
+	origin.repoFiles = repoSettings{}
+	if origin.repoSettingsPolicy().Disable {
+		return
+	}
+
+	var config RepoConfig
+	if content, found := readRepoFile(filesystem, path.Join(origin.SourceDir, repoConfigFileName)); found {
+		decoder := yamlv3.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&config); err != nil {
+			log.Warnf("Ignoring %s of %s: %s", repoConfigFileName, origin.URL, err)
+			config = RepoConfig{}
+		}
+	}
+
+	if origin.allowsRepoSetting(RepoSettingExclude) {
+		var patterns []gitignore.Pattern
+		if content, found := readRepoFile(filesystem, path.Join(origin.SourceDir, monakoIgnoreFileName)); found {
+			patterns = append(patterns, parseIgnorePatterns(string(content))...)
+		}
+		for _, exclude := range config.Exclude {
+			patterns = append(patterns, gitignore.ParsePattern(exclude, nil))
+		}
+		if len(patterns) > 0 {
+			origin.repoFiles.ignore = gitignore.NewMatcher(patterns)
+		}
+
+		if content, found := readRepoFile(filesystem, path.Join(origin.SourceDir, gitattributesFileName)); found {
+			attributes, err := gitattributes.ReadAttributes(bytes.NewReader(content), nil, true)
+			if err != nil {
+				log.Warnf("Ignoring %s of %s: %s", gitattributesFileName, origin.URL, err)
+			} else {
+				origin.repoFiles.attributes = gitattributes.NewMatcher(attributes)
+			}
+		}
+	} else if len(config.Exclude) > 0 {
+		log.Warnf("Ignoring exclude of %s of %s, it is not allowed", repoConfigFileName, origin.URL)
+	}
+
+	var frontmatter FrontmatterConfig
+	if config.Frontmatter != nil {
+		if origin.allowsRepoSetting(RepoSettingFrontmatter) {
+			frontmatter.Defaults = config.Frontmatter.Defaults
+			for j, rule := range config.Frontmatter.Rules {
+				if problem := checkPathPattern(rule.Match); problem != "" {
+					log.Warnf("Ignoring rule %d of %s of %s: match %s", j, repoConfigFileName, origin.URL, problem)
+					continue
+				}
+				frontmatter.Rules = append(frontmatter.Rules, rule)
+			}
+		} else {
+			log.Warnf("Ignoring frontmatter of %s of %s, it is not allowed", repoConfigFileName, origin.URL)
+		}
+	}
+	if config.Menu != nil {
+		if origin.allowsRepoSetting(RepoSettingMenu) {
+			if rule, found := origin.menuRule(filesystem, config.Menu); found {
+				frontmatter.Rules = append(frontmatter.Rules, rule)
+			} else {
+				log.Warnf("Ignoring menu of %s of %s, %s has no index document", repoConfigFileName, origin.URL, origin.SourceDir)
+			}
+		} else {
+			log.Warnf("Ignoring menu of %s of %s, it is not allowed", repoConfigFileName, origin.URL)
+		}
+	}
+	if frontmatter.Defaults != nil || frontmatter.Rules != nil {
+		origin.repoFiles.frontmatter = &frontmatter
+	}
+}
+
+// readRepoFile returns the content of the file in the filesystem, if it exists
+func readRepoFile(filesystem billy.Filesystem, remotePath string) ([]byte, bool) {
+	content, err := util.ReadFile(filesystem, remotePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Can't read %s: %s", remotePath, err)
+		}
+		return nil, false
+	}
+	return content, true
+}
+
+// parseIgnorePatterns returns the patterns of a file in gitignore syntax
+func parseIgnorePatterns(content string) []gitignore.Pattern {
+	var patterns []gitignore.Pattern
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, gitignore.ParsePattern(line, nil))
+	}
+	return patterns
+}
+
+// indexDocumentNames are the names of the documents shown for a folder in the menu, without extension
+var indexDocumentNames = []string{"_index", "index", "readme"}
+
+// globCharacters matches the characters with a special meaning in patterns
+var globCharacters = regexp.MustCompile(`[*?\[\]\\]`)
+
+// menuRule returns the front matter rule adding the menu hints to the index document of the docdir
+func (origin *Origin) menuRule(filesystem billy.Filesystem, hints *MenuHints) (FrontmatterRule, bool) {
+	entries, err := filesystem.ReadDir(origin.SourceDir)
+	if err != nil {
+		return FrontmatterRule{}, false
+	}
+
+	index := ""
+	for _, name := range indexDocumentNames {
+		for _, entry := range entries {
+			base := strings.TrimSuffix(entry.Name(), path.Ext(entry.Name()))
+			if !entry.IsDir() && strings.EqualFold(base, name) && helpers.FileIsListed(entry.Name(), origin.FileWhitelist) {
+				index = entry.Name()
+				break
+			}
+		}
+		if index != "" {
+			break
+		}
+	}
+	if index == "" {
+		return FrontmatterRule{}, false
+	}
+
+	set := map[string]interface{}{}
+	if hints.Title != "" {
+		set["title"] = hints.Title
+	}
+	if hints.Weight != nil {
+		set["weight"] = *hints.Weight
+	}
+	if hints.Collapse {
+		set["bookCollapseSection"] = true
+	}
+	if hints.Hidden {
+		set["bookHidden"] = true
+	}
+	return FrontmatterRule{Match: globCharacters.ReplaceAllString(index, `\$0`), Set: set}, true
+}
+
+// isIgnored returns true if the file or folder at remotePath is excluded by the files in the docdir
+func (origin *Origin) isIgnored(remotePath string, isDir bool) bool {
+	settings := origin.repoFiles
+	relativePath := strings.TrimPrefix(path.Clean(remotePath), path.Clean(origin.SourceDir)+"/")
+	if !isDir && !origin.repoSettingsPolicy().Disable {
+		switch relativePath {
+		case monakoIgnoreFileName, gitattributesFileName, repoConfigFileName:
+			return true
+		}
+	}
+
+	elements := strings.Split(relativePath, "/")
+	if settings.ignore != nil && settings.ignore.Match(elements, isDir) {
+		log.Debugf("Skipping %s, it is excluded by %s", remotePath, monakoIgnoreFileName)
+		return true
+	}
+	if settings.attributes != nil {
+		if results, matched := settings.attributes.Match(elements, []string{"export-ignore"}); matched && results["export-ignore"].IsSet() {
+			log.Debugf("Skipping %s, it is export-ignore in %s", remotePath, gitattributesFileName)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package compose
+
+// run: go test ./pkg/compose -run TestRepoSettings
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepoSettings(t *testing.T) {
+	files := map[string]string{
+		"docs/.monakoignore":        "# Comment\ndrafts/\n*.tmp.md\n!keep.tmp.md\n",
+		"docs/.gitattributes":       "internal/secret.md export-ignore\n",
+		"docs/.monako.yaml":         "exclude: [old.md]\nfrontmatter:\n  defaults:\n    tags: [payments]\n  rules:\n    - match: \"internal/**\"\n      set:\n        bookHidden: true\n    - match: \"[a-\"\nmenu:\n  title: Payments\n  weight: 10\n  collapse: true\n",
+		"docs/README.md":            "# Readme",
+		"docs/guide.md":             "# Guide",
+		"docs/old.md":               "# Old",
+		"docs/notes.tmp.md":         "# Notes",
+		"docs/keep.tmp.md":          "# Keep",
+		"docs/drafts/draft.md":      "# Draft",
+		"docs/internal/secret.md":   "# Secret",
+		"docs/internal/internal.md": "# Internal",
+		"README.md":                 "# Outside of docdir",
+	}
+
+	compose := func(t *testing.T, origin Origin, global FrontmatterConfig) (*Config, func(string) string) {
+		config, _ := getTestConfig(t, origin)
+		config.Frontmatter = global
+		assert.NoError(t, config.Origins[0].ComposeDir(context.Background(), newTestFilesystem(t, files)))
+		return config, func(name string) string {
+			content, err := ioutil.ReadFile(filepath.Join(config.ContentWorkingDir, "docs", name))
+			if err != nil {
+				return ""
+			}
+			return string(content)
+		}
+	}
+	composedFiles := func(config *Config) []string {
+		var composed []string
+		for _, file := range config.Origins[0].Files {
+			composed = append(composed, file.RemotePath)
+		}
+		return composed
+	}
+
+	t.Run("All settings", func(t *testing.T) {
+		config, read := compose(t, Origin{
+			SourceDir:     "docs",
+			TargetDir:     "docs",
+			FileWhitelist: []string{".md", ".yaml"},
+			Frontmatter:   &FrontmatterConfig{Defaults: map[string]interface{}{"tags": []interface{}{"central"}}},
+		}, FrontmatterConfig{Defaults: map[string]interface{}{"tags": []interface{}{"global"}, "draft": false}})
+
+		assert.ElementsMatch(t, []string{"docs/README.md", "docs/guide.md", "docs/keep.tmp.md", "docs/internal/internal.md"}, composedFiles(config))
+		assert.Equal(t, "---\ndraft: false\ntags:\n- central\nbookCollapseSection: true\ntitle: Payments\nweight: 10\n---\n# Readme", read("README.md"))
+		assert.Contains(t, read("internal/internal.md"), "bookHidden: true\n")
+		assert.NotContains(t, read("guide.md"), "bookHidden")
+	})
+
+	t.Run("Repository replaces global settings", func(t *testing.T) {
+		_, read := compose(t, Origin{SourceDir: "docs", TargetDir: "docs", FileWhitelist: []string{".md"}},
+			FrontmatterConfig{Defaults: map[string]interface{}{"tags": []interface{}{"global"}}})
+		assert.Contains(t, read("guide.md"), "tags:\n- payments\n")
+	})
+
+	t.Run("Restricted", func(t *testing.T) {
+		config, read := compose(t, Origin{
+			SourceDir:     "docs",
+			TargetDir:     "docs",
+			FileWhitelist: []string{".md"},
+			RepoSettings:  &RepoSettingsPolicy{Allow: []string{RepoSettingMenu}},
+		}, FrontmatterConfig{})
+
+		assert.Len(t, composedFiles(config), 8)
+		assert.Contains(t, read("README.md"), "title: Payments\n")
+		assert.NotContains(t, read("internal/internal.md"), "bookHidden")
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		config, read := compose(t, Origin{
+			SourceDir:     "docs",
+			TargetDir:     "docs",
+			FileWhitelist: []string{".md", ".yaml"},
+			RepoSettings:  &RepoSettingsPolicy{Disable: true},
+		}, FrontmatterConfig{})
+
+		assert.Len(t, composedFiles(config), 9)
+		assert.Contains(t, composedFiles(config), "docs/.monako.yaml")
+		assert.Equal(t, "# Readme", read("README.md"))
+	})
+
+	t.Run("Invalid fragment", func(t *testing.T) {
+		config, _ := getTestConfig(t, Origin{SourceDir: "docs", TargetDir: "docs", FileWhitelist: []string{".md"}})
+		assert.NoError(t, config.Origins[0].ComposeDir(context.Background(), newTestFilesystem(t, map[string]string{
+			"docs/.monako.yaml": "unknown: true\n",
+			"docs/README.md":    "# Readme",
+		})))
+		assert.Len(t, composedFiles(config), 1)
+		assert.Nil(t, config.Origins[0].repoFiles.frontmatter)
+	})
+
+	t.Run("Validation", func(t *testing.T) {
+		configFile := writeTestConfig(t, `
+repoSettings:
+  allow: [exclude, titles]
+origins:
+  - src: https://github.com/snipem/monako-test.git
+    branch: master
+    repoSettings:
+      allow: [menus]
+`)
+		_, err := LoadConfig(configFile, "")
+		assert.Error(t, err)
+		errs := err.(ConfigErrors)
+		assert.Len(t, errs, 2)
+		assert.Equal(t, "repoSettings.allow[1]", errs[0].Field)
+		assert.Equal(t, 3, errs[0].Line)
+		assert.Contains(t, errs[0].Message, "unknown setting, use one of exclude, frontmatter, menu")
+		assert.Equal(t, "origins[0].repoSettings.allow[0]", errs[1].Field)
+	})
+}
@@ -0,0 +1,186 @@
+package compose
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// StaleReportFileName is the name of the stale documentation report in the compose folder
+const StaleReportFileName = "monako-stale.json"
+
+// StalenessConfig marks documents that have not been changed for a while as stale
+type StalenessConfig struct {
+	// Days since the last commit after which a document is stale. Staleness is not checked if 0
+	Days int `yaml:"days,omitempty"`
+	// MaxStale fails the build if more documents are stale. Only supported globally
+	MaxStale *int `yaml:"maxStale,omitempty"`
+}
+
+// StaleReport lists the stale documents of all origins
+type StaleReport struct {
+	GeneratedAt time.Time     `json:"generatedAt"`
+	Count       int           `json:"count"`
+	Origins     []StaleOrigin `json:"origins"`
+}
+
+// StaleOrigin lists the stale documents of an origin grouped by the author of their last commit
+type StaleOrigin struct {
+	URL     string        `json:"url"`
+	Days    int           `json:"days"`
+	Authors []StaleAuthor `json:"authors"`
+}
+
+// StaleAuthor lists the stale documents last changed by an author
+type StaleAuthor struct {
+	Name      string          `json:"name"`
+	Email     string          `json:"email"`
+	Documents []StaleDocument `json:"documents"`
+}
+
+// StaleDocument describes a stale document
+type StaleDocument struct {
+	RemotePath string    `json:"remotePath"`
+	URL        string    `json:"url,omitempty"`
+	LastCommit time.Time `json:"lastCommit"`
+	// Age is the number of days since the last commit
+	Age int `json:"age"`
+}
+
+// staleAfterDays returns the days after which documents of the origin are stale, 0 if staleness is not checked
+func (origin *Origin) staleAfterDays() int {
+	if origin.Staleness != nil {
+		return origin.Staleness.Days
+	}
+	if origin.config == nil {
+		return 0
+	}
+	return origin.config.Staleness.Days
+}
+
+// stalenessEnabled returns true if staleness is checked for any origin
+func (config *Config) stalenessEnabled() bool {
+	for i := range config.Origins {
+		if config.Origins[i].staleAfterDays() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// isStale returns true if the last commit of the file is older than the staleness threshold of its origin
+func (file *OriginFile) isStale(now time.Time) bool {
+	days := file.parentOrigin.staleAfterDays()
+	if days <= 0 || file.Commit == nil || file.Commit.Date.IsZero() {
+		return false
+	}
+	return now.Sub(file.Commit.Date) > time.Duration(days)*24*time.Hour
+}
+
+// newStaleReport returns the report of all stale documents at the given time
+func (config *Config) newStaleReport(now time.Time) *StaleReport {
+	report := &StaleReport{GeneratedAt: now.UTC(), Origins: []StaleOrigin{}}
+
+	for i := range config.Origins {
+		origin := &config.Origins[i]
+		staleOrigin := StaleOrigin{URL: origin.URL, Days: origin.staleAfterDays()}
+		authorIndex := map[string]int{}
+
+		for j := range origin.Files {
+			file := &origin.Files[j]
+			if file.GetFormat() == "" || !file.isStale(now) {
+				continue
+			}
+
+			key := strings.ToLower(file.Commit.Author.Email)
+			if _, found := authorIndex[key]; !found {
+				authorIndex[key] = len(staleOrigin.Authors)
+				staleOrigin.Authors = append(staleOrigin.Authors, StaleAuthor{Name: file.Commit.Author.Name, Email: file.Commit.Author.Email})
+			}
+			author := &staleOrigin.Authors[authorIndex[key]]
+			author.Documents = append(author.Documents, StaleDocument{
+				RemotePath: file.RemotePath,
+				URL:        getWebLinkForFileInGit(origin.URL, origin.Branch, file.RemotePath, origin.gitProviderHosts()),
+				LastCommit: file.Commit.Date,
+				Age:        int(now.Sub(file.Commit.Date).Hours() / 24),
+			})
+			report.Count++
+		}
+
+		if len(staleOrigin.Authors) == 0 {
+			continue
+		}
+		// Authors with the most stale documents first, oldest documents first
+		sort.SliceStable(staleOrigin.Authors, func(a, b int) bool {
+			return len(staleOrigin.Authors[a].Documents) > len(staleOrigin.Authors[b].Documents)
+		})
+		for _, author := range staleOrigin.Authors {
+			documents := author.Documents
+			sort.SliceStable(documents, func(a, b int) bool {
+				return documents[a].LastCommit.Before(documents[b].LastCommit)
+			})
+		}
+		report.Origins = append(report.Origins, staleOrigin)
+	}
+	return report
+}
+
+// Write prints the report in a human readable form
+func (report *StaleReport) Write(w io.Writer) {
+	fmt.Fprintf(w, "%d stale documents\n", report.Count)
+	for _, origin := range report.Origins {
+		fmt.Fprintf(w, "%s (older than %d days)\n", origin.URL, origin.Days)
+		for _, author := range origin.Authors {
+			if author.Email != "" {
+				fmt.Fprintf(w, "  %s <%s>\n", author.Name, author.Email)
+			} else {
+				fmt.Fprintf(w, "  %s\n", author.Name)
+			}
+			for _, document := range author.Documents {
+				fmt.Fprintf(w, "    %s (%s, %d days)\n", document.RemotePath, document.LastCommit.Format("2006-01-02"), document.Age)
+			}
+		}
+	}
+}
+
+// writeStaleReport writes the report as JSON to the compose folder
+func (config *Config) writeStaleReport(report *StaleReport) error {
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Error encoding stale report")
+	}
+	err = ioutil.WriteFile(filepath.Join(config.HugoWorkingDir, StaleReportFileName), content, standardFilemode)
+	if err != nil {
+		return errors.Wrap(err, "Error writing stale report")
+	}
+	return nil
+}
+
+// checkStaleness reports the stale documents and fails if more are stale than allowed
+func (config *Config) checkStaleness(w io.Writer) error {
+	if !config.stalenessEnabled() {
+		return nil
+	}
+
+	report := config.newStaleReport(time.Now())
+	err := config.writeStaleReport(report)
+	if err != nil {
+		return err
+	}
+	if report.Count > 0 {
+		report.Write(w)
+	}
+
+	maxStale := config.Staleness.MaxStale
+	if maxStale != nil && report.Count > *maxStale {
+		return fmt.Errorf("%d documents are stale, at most %d are allowed", report.Count, *maxStale)
+	}
+	return nil
+}
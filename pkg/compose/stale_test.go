@@ -0,0 +1,130 @@
+package compose
+
+// run: go test ./pkg/compose -run TestStale
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaleReport(t *testing.T) {
+	now := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	jane := OriginFileCommitter{Name: "Jane", Email: "jane@example.com"}
+	john := OriginFileCommitter{Name: "John", Email: "john@example.com"}
+
+	config, _ := getTestConfig(t,
+		Origin{URL: "https://github.com/snipem/monako-test.git", Branch: "master"},
+		Origin{URL: "https://github.com/snipem/monako.git", Branch: "master", Staleness: &StalenessConfig{Days: 0}},
+	)
+	config.Staleness = StalenessConfig{Days: 30}
+
+	addFile := func(origin *Origin, remotePath string, author OriginFileCommitter, age int) {
+		origin.Files = append(origin.Files, OriginFile{
+			RemotePath:   remotePath,
+			parentOrigin: origin,
+			Commit:       &OriginFileCommit{Hash: "abc", Author: author, Date: now.Add(-time.Duration(age) * 24 * time.Hour)},
+		})
+	}
+	addFile(&config.Origins[0], "docs/new.md", jane, 10)
+	addFile(&config.Origins[0], "docs/old.md", jane, 100)
+	addFile(&config.Origins[0], "docs/older.md", jane, 200)
+	addFile(&config.Origins[0], "docs/image.png", john, 200)
+	addFile(&config.Origins[0], "docs/other.adoc", john, 40)
+	addFile(&config.Origins[1], "docs/old.md", john, 400)
+
+	report := config.newStaleReport(now)
+	assert.Equal(t, 3, report.Count)
+	assert.Equal(t, []StaleOrigin{{
+		URL:  "https://github.com/snipem/monako-test.git",
+		Days: 30,
+		Authors: []StaleAuthor{
+			{Name: "Jane", Email: "jane@example.com", Documents: []StaleDocument{
+				{RemotePath: "docs/older.md", URL: "https://github.com/snipem/monako-test/blob/master/docs/older.md", LastCommit: now.Add(-200 * 24 * time.Hour), Age: 200},
+				{RemotePath: "docs/old.md", URL: "https://github.com/snipem/monako-test/blob/master/docs/old.md", LastCommit: now.Add(-100 * 24 * time.Hour), Age: 100},
+			}},
+			{Name: "John", Email: "john@example.com", Documents: []StaleDocument{
+				{RemotePath: "docs/other.adoc", URL: "https://github.com/snipem/monako-test/blob/master/docs/other.adoc", LastCommit: now.Add(-40 * 24 * time.Hour), Age: 40},
+			}},
+		},
+	}}, report.Origins)
+
+	var out bytes.Buffer
+	report.Write(&out)
+	assert.Equal(t, `3 stale documents
+https://github.com/snipem/monako-test.git (older than 30 days)
+  Jane <jane@example.com>
+    docs/older.md (2019-10-14, 200 days)
+    docs/old.md (2020-01-22, 100 days)
+  John <john@example.com>
+    docs/other.adoc (2020-03-22, 40 days)
+`, out.String())
+
+	t.Run("Front matter", func(t *testing.T) {
+		config.Staleness.Days = 1
+		content, err := config.Origins[0].Files[0].ExpandFrontmatter("# New")
+		assert.NoError(t, err)
+		assert.Contains(t, content, "MonakoGitStale: true\n")
+
+		content, err = config.Origins[1].Files[0].ExpandFrontmatter("# Old")
+		assert.NoError(t, err)
+		assert.NotContains(t, content, "MonakoGitStale")
+	})
+
+	t.Run("Fail threshold", func(t *testing.T) {
+		assert.NoError(t, os.MkdirAll(config.HugoWorkingDir, standardFilemode))
+		config.Staleness = StalenessConfig{Days: 30}
+
+		maxStale := 4
+		config.Staleness.MaxStale = &maxStale
+		var out bytes.Buffer
+		assert.NoError(t, config.checkStaleness(&out))
+		assert.Contains(t, out.String(), "4 stale documents\n")
+
+		content, err := ioutil.ReadFile(filepath.Join(config.HugoWorkingDir, StaleReportFileName))
+		assert.NoError(t, err)
+		var written StaleReport
+		assert.NoError(t, json.Unmarshal(content, &written))
+		assert.Equal(t, 4, written.Count)
+
+		maxStale = 3
+		err = config.checkStaleness(&out)
+		assert.EqualError(t, err, "4 documents are stale, at most 3 are allowed")
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		config.Staleness = StalenessConfig{}
+		assert.False(t, config.stalenessEnabled())
+		assert.NoError(t, config.checkStaleness(&bytes.Buffer{}))
+	})
+}
+
+func TestStaleValidation(t *testing.T) {
+	configFile := writeTestConfig(t, `
+staleness:
+  days: -1
+  maxStale: -1
+origins:
+  - src: https://github.com/snipem/monako-test.git
+    branch: master
+    staleness:
+      days: 10
+      maxStale: 5
+`)
+	_, err := LoadConfig(configFile, "")
+	assert.Error(t, err)
+	errs := err.(ConfigErrors)
+	assert.Len(t, errs, 3)
+	assert.Equal(t, "staleness.days", errs[0].Field)
+	assert.Equal(t, 3, errs[0].Line)
+	assert.Equal(t, "staleness.maxStale", errs[1].Field)
+	assert.Contains(t, errs[1].Message, "must not be negative")
+	assert.Equal(t, "origins[0].staleness.maxStale", errs[2].Field)
+	assert.Contains(t, errs[2].Message, "only supported globally")
+}
@@ -0,0 +1,87 @@
+package compose
+
+import (
+	"regexp"
+	"strings"
+)
+
+// markdownATXHeading matches first level headings like "# Title" or "# Title #"
+var markdownATXHeading = regexp.MustCompile(`^ {0,3}#[ \t]+(.*?)(?:[ \t]+#+)?[ \t]*$`)
+
+// markdownSetextUnderline matches the underline of first level headings like "Title\n====="
+var markdownSetextUnderline = regexp.MustCompile(`^ {0,3}=+[ \t]*$`)
+
+// markdownFence matches the start and end of fenced code blocks
+var markdownFence = regexp.MustCompile("^ {0,3}(```+|~~~+)")
+
+// asciidocTitle matches the document title like "= Title"
+var asciidocTitle = regexp.MustCompile(`^=[ \t]+(\S.*?)[ \t]*$`)
+
+// asciidocDelimiter matches the delimiters of blocks like listings, examples and comments
+var asciidocDelimiter = regexp.MustCompile(`^(-{4,}|\.{4,}|={4,}|\*{4,}|_{4,}|\+{4,}|/{4,})[ \t]*$`)
+
+// extractTitle returns the title of the body of a document of the given format and the body without
+// the lines of its title. The title is empty if the document has none
+func extractTitle(body string, format string) (title string, stripped string) {
+	lines := strings.Split(body, "\n")
+
+	var start, end int
+	switch format {
+	case Markdown:
+		title, start, end = markdownTitle(lines)
+	case Asciidoc:
+		title, start, end = asciidocDocumentTitle(lines)
+	}
+	if title == "" {
+		return "", body
+	}
+	return title, strings.Join(append(lines[:start:start], lines[end:]...), "\n")
+}
+
+// markdownTitle returns the first level one heading of the Markdown lines and the range of its lines
+func markdownTitle(lines []string) (string, int, int) {
+	fence := ""
+	for i, line := range lines {
+		if fence != "" {
+			if strings.HasPrefix(strings.TrimSpace(line), fence) {
+				fence = ""
+			}
+			continue
+		}
+		if match := markdownFence.FindStringSubmatch(line); match != nil {
+			fence = match[1]
+			continue
+		}
+
+		if match := markdownATXHeading.FindStringSubmatch(line); match != nil && match[1] != "" {
+			return match[1], i, i + 1
+		}
+		if strings.TrimSpace(line) != "" && i+1 < len(lines) && markdownSetextUnderline.MatchString(lines[i+1]) {
+			return strings.TrimSpace(line), i, i + 2
+		}
+	}
+	return "", 0, 0
+}
+
+// asciidocDocumentTitle returns the document title of the AsciiDoc lines and the range of its line
+func asciidocDocumentTitle(lines []string) (string, int, int) {
+	delimiter := ""
+	for i, line := range lines {
+		if match := asciidocDelimiter.FindStringSubmatch(line); match != nil {
+			if delimiter == "" {
+				delimiter = match[1]
+			} else if delimiter == match[1] {
+				delimiter = ""
+			}
+			continue
+		}
+		if delimiter != "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+
+		if match := asciidocTitle.FindStringSubmatch(line); match != nil {
+			return match[1], i, i + 1
+		}
+	}
+	return "", 0, 0
+}
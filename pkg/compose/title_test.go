@@ -0,0 +1,74 @@
+package compose
+
+// run: go test ./pkg/compose -run TestTitle
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTitleExtraction(t *testing.T) {
+	for _, tc := range []struct {
+		name, body, format, title, stripped string
+	}{
+		{"Markdown heading", "Intro\n\n# Monako Test #\n\nReadme", Markdown, "Monako Test", "Intro\n\n\nReadme"},
+		{"Markdown setext heading", "Monako Test\n===\n\nReadme", Markdown, "Monako Test", "\nReadme"},
+		{"Markdown second level only", "## Second\n\nSecond\n---", Markdown, "", "## Second\n\nSecond\n---"},
+		{"Markdown heading in code block", "```sh\n# comment\n```\n\n# Title", Markdown, "Title", "```sh\n# comment\n```\n"},
+		{"Markdown hashtag", "#hashtag\n# \n", Markdown, "", "#hashtag\n# \n"},
+		{"AsciiDoc title", "// Comment\n= Asciidoc First Level\n:toc:\n\n== Second", Asciidoc, "Asciidoc First Level", "// Comment\n:toc:\n\n== Second"},
+		{"AsciiDoc title in listing", "----\n= Listing\n----\n== Second", Asciidoc, "", "----\n= Listing\n----\n== Second"},
+		{"Other formats", "# Title", "", "", "# Title"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			title, stripped := extractTitle(tc.body, tc.format)
+			assert.Equal(t, tc.title, title)
+			assert.Equal(t, tc.stripped, stripped)
+		})
+	}
+}
+
+func TestTitleCompose(t *testing.T) {
+	files := map[string]string{
+		"docs/README.md":   "# Monako Test\n\nReadme",
+		"docs/titled.md":   "---\ntitle: Own Title\n---\n# Heading",
+		"docs/untitled.md": "Text only",
+		"docs/guide.adoc":  "= Guide\n\nText",
+	}
+	read := func(t *testing.T, config *Config, name string) string {
+		content, err := ioutil.ReadFile(filepath.Join(config.ContentWorkingDir, "docs", name))
+		assert.NoError(t, err)
+		return string(content)
+	}
+
+	t.Run("Titles are extracted", func(t *testing.T) {
+		config, _ := getTestConfig(t, Origin{SourceDir: "docs", TargetDir: "docs", FileWhitelist: []string{".md", ".adoc"},
+			Frontmatter: &FrontmatterConfig{ExtractTitle: true}})
+		assert.NoError(t, config.Origins[0].ComposeDir(context.Background(), newTestFilesystem(t, files)))
+
+		assert.Equal(t, "---\ntitle: Monako Test\n---\n# Monako Test\n\nReadme", read(t, config, "README.md"))
+		assert.Equal(t, "---\ntitle: Own Title\n---\n# Heading", read(t, config, "titled.md"))
+		assert.Equal(t, "Text only", read(t, config, "untitled.md"))
+		assert.Equal(t, "---\ntitle: Guide\n---\n= Guide\n\nText", read(t, config, "guide.adoc"))
+	})
+
+	t.Run("Titles are stripped", func(t *testing.T) {
+		config, _ := getTestConfig(t, Origin{SourceDir: "docs", TargetDir: "docs", FileWhitelist: []string{".md"},
+			Frontmatter: &FrontmatterConfig{ExtractTitle: true, StripTitle: true}})
+		assert.NoError(t, config.Origins[0].ComposeDir(context.Background(), newTestFilesystem(t, files)))
+
+		assert.Equal(t, "---\ntitle: Monako Test\n---\n\nReadme", read(t, config, "README.md"))
+		assert.Equal(t, "---\ntitle: Own Title\n---\n# Heading", read(t, config, "titled.md"))
+	})
+
+	t.Run("Title extraction is disabled by default", func(t *testing.T) {
+		config, _ := getTestConfig(t, Origin{SourceDir: "docs", TargetDir: "docs", FileWhitelist: []string{".md"}})
+		assert.NoError(t, config.Origins[0].ComposeDir(context.Background(), newTestFilesystem(t, files)))
+
+		assert.Equal(t, "# Monako Test\n\nReadme", read(t, config, "README.md"))
+	})
+}
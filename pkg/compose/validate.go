@@ -0,0 +1,534 @@
+package compose
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// ConfigError describes a single problem found in a Monako config
+type ConfigError struct {
+	// File is the path of the config file, empty if the config was not read from a file
+	File string
+	// Line is the line in File where the problem was found, 0 if unknown
+	Line int
+	// Field is the path of the affected field, for example "origins[1].targetdir"
+	Field string
+	// Message describes the problem
+	Message string
+}
+
+func (e ConfigError) Error() string {
+	location := e.File
+	if e.Line > 0 {
+		location = fmt.Sprintf("%s:%d", location, e.Line)
+	}
+	message := e.Message
+	if e.Field != "" {
+		message = fmt.Sprintf("%s: %s", e.Field, e.Message)
+	}
+	if location == "" {
+		return message
+	}
+	return fmt.Sprintf("%s: %s", location, message)
+}
+
+// ConfigErrors contains all problems found in a Monako config
+type ConfigErrors []ConfigError
+
+func (errs ConfigErrors) Error() string {
+	messages := make([]string, len(errs))
+	for i, e := range errs {
+		messages[i] = e.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// configSource is the parsed YAML document of a config file. It is used for
+// detecting unknown fields and looking up line numbers of fields
+type configSource struct {
+	file string
+	root *yamlv3.Node
+	// files maps nodes to the config file they have been read from if it
+	// differs from file, for example for included config files
+	files map[*yamlv3.Node]string
+}
+
+// yamlErrorLine matches the line information in error messages of the config parsers
+var yamlErrorLine = regexp.MustCompile(`(?:Near )?line (\d+)(?: \(last key parsed '[^']*'\))?: `)
+
+// newConfigError returns a config error from a parser error. The line number is
+// extracted from the error message if present
+func newConfigError(file string, err error) ConfigError {
+	message := strings.TrimPrefix(strings.TrimPrefix(err.Error(), "yaml: "), "toml: ")
+	configErr := ConfigError{File: file, Message: message}
+
+	if match := yamlErrorLine.FindStringSubmatchIndex(message); match != nil {
+		configErr.Line, _ = strconv.Atoi(message[match[2]:match[3]])
+		configErr.Message = message[:match[0]] + message[match[1]:]
+	}
+	return configErr
+}
+
+// position returns the config file and line of the field described by the given path of
+// mapping keys (string) and sequence indexes (int). The line is 0 if it can't be determined
+func (source *configSource) position(fieldPath ...interface{}) (file string, line int) {
+	if source == nil || source.root == nil {
+		return "", 0
+	}
+
+	node := source.root
+	positionNode := node
+	for _, element := range fieldPath {
+		if node.Kind == yamlv3.DocumentNode && len(node.Content) > 0 {
+			node = node.Content[0]
+		}
+
+		found := false
+		switch key := element.(type) {
+		case string:
+			if i := mappingIndex(node, key); i >= 0 && node.Kind == yamlv3.MappingNode {
+				positionNode = node.Content[i]
+				node = node.Content[i+1]
+				found = true
+			}
+		case int:
+			if node.Kind == yamlv3.SequenceNode && key < len(node.Content) {
+				node = node.Content[key]
+				positionNode = node
+				found = true
+			}
+		}
+		if !found {
+			break
+		}
+	}
+
+	file = source.file
+	if nodeFile, isKnown := source.files[positionNode]; isKnown {
+		file = nodeFile
+	}
+	return file, positionNode.Line
+}
+
+// checkTypes returns an error for every value that doesn't match the type of its field
+func (source *configSource) checkTypes() ConfigErrors {
+	var errs ConfigErrors
+	err := source.root.Decode(&Config{})
+	if typeErr, isTypeErr := err.(*yamlv3.TypeError); isTypeErr {
+		for _, message := range typeErr.Errors {
+			errs = append(errs, newConfigError(source.file, errors.New(message)))
+		}
+	} else if err != nil {
+		errs = append(errs, newConfigError(source.file, err))
+	}
+	return errs
+}
+
+// checkFields returns an error for every unknown or duplicate field in the config source
+func (source *configSource) checkFields() ConfigErrors {
+	if source == nil || source.root == nil || len(source.root.Content) == 0 {
+		return nil
+	}
+	return source.checkNode(source.root.Content[0], reflect.TypeOf(Config{}), "")
+}
+
+func (source *configSource) checkNode(node *yamlv3.Node, t reflect.Type, field string) ConfigErrors {
+	var errs ConfigErrors
+
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yamlv3.MappingNode {
+			return nil
+		}
+		fields := yamlFields(t)
+		seen := make(map[string]int)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			keyField := joinField(field, key.Value)
+
+			if firstLine, isDuplicate := seen[key.Value]; isDuplicate {
+				errs = append(errs, ConfigError{
+					File:    source.file,
+					Line:    key.Line,
+					Field:   keyField,
+					Message: fmt.Sprintf("duplicate field, already defined in line %d", firstLine),
+				})
+				continue
+			}
+			seen[key.Value] = key.Line
+
+			fieldType, known := fields[key.Value]
+			if !known {
+				errs = append(errs, ConfigError{
+					File:    source.file,
+					Line:    key.Line,
+					Field:   keyField,
+					Message: unknownFieldMessage(key.Value, fields),
+				})
+				continue
+			}
+			errs = append(errs, source.checkNode(node.Content[i+1], fieldType, keyField)...)
+		}
+	case reflect.Slice:
+		if node.Kind != yamlv3.SequenceNode {
+			return nil
+		}
+		for i, element := range node.Content {
+			errs = append(errs, source.checkNode(element, t.Elem(), fmt.Sprintf("%s[%d]", field, i))...)
+		}
+	}
+
+	return errs
+}
+
+// yamlFields returns the YAML field names of a struct type with their types.
+// Fields without a YAML tag can't be configured
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("yaml")
+		name := strings.Split(tag, ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = t.Field(i).Type
+	}
+	return fields
+}
+
+// unknownFieldMessage returns the error message for an unknown field with a
+// suggestion for fields with a similar name
+func unknownFieldMessage(name string, fields map[string]reflect.Type) string {
+	for known := range fields {
+		if normalizeFieldName(known) == normalizeFieldName(name) {
+			return fmt.Sprintf("unknown field, did you mean %q?", known)
+		}
+	}
+	return "unknown field"
+}
+
+func normalizeFieldName(name string) string {
+	return strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(name))
+}
+
+func joinField(parent string, field string) string {
+	if parent == "" {
+		return field
+	}
+	return parent + "." + field
+}
+
+// Validate checks the config for semantic problems like missing fields,
+// identical target dirs, paths leaving the compose directory and missing
+// environment variables for authentication. All problems found are returned
+func (config *Config) Validate() ConfigErrors {
+	var errs ConfigErrors
+
+	addError := func(message string, fieldPath ...interface{}) {
+		errs = append(errs, config.configError(message, fieldPath...))
+	}
+
+	if len(config.Origins) == 0 {
+		addError("at least one origin is required", "origins")
+	}
+	if config.Timeout < 0 {
+		addError("timeout must not be negative", "timeout")
+	}
+	if config.History < 0 {
+		addError("history must not be negative", "history")
+	}
+	if config.Collisions != "" && !isCollisionPolicy(config.Collisions) {
+		addError(fmt.Sprintf("unknown policy, use one of %s", strings.Join(collisionPolicies, ", ")), "collisions")
+	}
+	for host, name := range config.GitProviders {
+		if _, isRegistered := getGitProvider(name); !isRegistered {
+			addError(fmt.Sprintf("unknown provider, use one of %s", strings.Join(registeredGitProviderNames(), ", ")), "gitProviders", host)
+		}
+	}
+	errs = append(errs, config.validateFrontmatter(&config.Frontmatter, "frontmatter")...)
+	errs = append(errs, config.validateStaleness(&config.Staleness, true, "staleness")...)
+	errs = append(errs, config.validateRepoSettings(&config.RepoSettings, "repoSettings")...)
+	errs = append(errs, config.validateProcessors(config.Processors)...)
+	errs = append(errs, config.validateHooks()...)
+
+	for i, origin := range config.Origins {
+		if _, isRegistered := getFetcher(origin.Type); !isRegistered {
+			addError(fmt.Sprintf("unknown type, use one of %s", strings.Join(registeredFetcherTypes(), ", ")), "origins", i, "type")
+		}
+
+		if origin.Discover != nil {
+			errs = append(errs, config.validateDiscovery(i)...)
+		} else {
+			if origin.URL == "" {
+				addError("field is required", "origins", i, "src")
+			}
+			if origin.Branch == "" && (origin.Type == "" || origin.Type == GitSource) {
+				addError("field is required", "origins", i, "branch")
+			}
+		}
+
+		for _, dir := range []struct{ field, value string }{
+			{"docdir", origin.SourceDir},
+			{"targetdir", origin.TargetDir},
+		} {
+			if problem := checkRelativePath(dir.value); problem != "" {
+				addError(problem, "origins", i, dir.field)
+			}
+		}
+
+		if origin.Timeout < 0 {
+			addError("timeout must not be negative", "origins", i, "timeout")
+		}
+		errs = append(errs, config.validateProcessors(origin.Processors, "origins", i)...)
+		errs = append(errs, config.validateFrontmatter(origin.Frontmatter, "origins", i, "frontmatter")...)
+		errs = append(errs, config.validateStaleness(origin.Staleness, false, "origins", i, "staleness")...)
+		errs = append(errs, config.validateRepoSettings(origin.RepoSettings, "origins", i, "repoSettings")...)
+
+		if (origin.EnvUsername == "") != (origin.EnvPassword == "") {
+			addError("envusername and envpassword have to be set together", "origins", i)
+		}
+		for _, env := range []struct{ field, variable string }{
+			{"envusername", origin.EnvUsername},
+			{"envpassword", origin.EnvPassword},
+		} {
+			if _, isSet := os.LookupEnv(env.variable); env.variable != "" && !isSet {
+				addError(fmt.Sprintf("environment variable %q is not set", env.variable), "origins", i, env.field)
+			}
+		}
+
+	}
+
+	for _, overlap := range config.findTargetDirOverlaps(config.Origins) {
+		if overlap.same {
+			addError(fmt.Sprintf("is the same as targetdir %q of origins[%d]", config.Origins[overlap.other].TargetDir, overlap.other), "origins", overlap.origin, "targetdir")
+		}
+	}
+
+	return errs
+}
+
+// Warnings checks the config for problems that don't fail the build, like nested target dirs.
+// All problems found are returned
+func (config *Config) Warnings() ConfigErrors {
+	var warnings ConfigErrors
+	for _, overlap := range config.findTargetDirOverlaps(config.Origins) {
+		if !overlap.same {
+			message := fmt.Sprintf("is nested with targetdir %q of origins[%d], files at the same path collide", config.Origins[overlap.other].TargetDir, overlap.other)
+			warnings = append(warnings, config.configError(message, "origins", overlap.origin, "targetdir"))
+		}
+	}
+	return warnings
+}
+
+// targetDirOverlap describes an origin whose targetdir is the same as or nested with the one of an earlier origin
+type targetDirOverlap struct {
+	origin int
+	other  int
+	same   bool
+}
+
+// findTargetDirOverlaps returns the origins whose targetdir overlaps with the one of an earlier origin.
+// Templates of discoveries are skipped. Identical targetdirs are allowed if there is a policy for
+// collisions, nested targetdirs only collide if both origins have a file at the same path
+func (config *Config) findTargetDirOverlaps(origins []Origin) []targetDirOverlap {
+	var overlaps []targetDirOverlap
+	if config.Collisions != "" {
+		return overlaps
+	}
+	for i, origin := range origins {
+		for j := 0; j < i && origin.Discover == nil; j++ {
+			other := origins[j]
+			if other.Discover != nil || !targetDirsOverlap(other.TargetDir, origin.TargetDir) {
+				continue
+			}
+			same := cleanTargetDir(other.TargetDir) == cleanTargetDir(origin.TargetDir)
+			overlaps = append(overlaps, targetDirOverlap{origin: i, other: j, same: same})
+		}
+	}
+	return overlaps
+}
+
+// configError returns a config error for the field described by the given path
+// of mapping keys (string) and sequence indexes (int)
+func (config *Config) configError(message string, fieldPath ...interface{}) ConfigError {
+	file, line := config.source.position(fieldPath...)
+	return ConfigError{
+		File:    file,
+		Line:    line,
+		Field:   fieldPathString(fieldPath...),
+		Message: message,
+	}
+}
+
+// validateDiscovery checks the discovery of the origin with the given index
+func (config *Config) validateDiscovery(i int) ConfigErrors {
+	var errs ConfigErrors
+	origin := config.Origins[i]
+	discovery := origin.Discover
+
+	addError := func(message string, fieldPath ...interface{}) {
+		errs = append(errs, config.configError(message, append([]interface{}{"origins", i}, fieldPath...)...))
+	}
+
+	if origin.URL != "" {
+		addError("src can't be set together with discover", "src")
+	}
+	if origin.Type != "" && origin.Type != GitSource {
+		addError("only git origins can be discovered", "type")
+	}
+	if _, isKnown := discoveryProviders[discovery.Provider]; !isKnown {
+		addError(fmt.Sprintf("unknown provider, use %s, %s or %s", GitHub, GitLab, Gitea), "discover", "provider")
+	}
+	if discovery.Organization == "" {
+		addError("field is required", "discover", "org")
+	}
+	if _, err := regexp.Compile(discovery.Name); err != nil {
+		addError(fmt.Sprintf("invalid regular expression: %s", err), "discover", "name")
+	}
+	if _, isSet := os.LookupEnv(discovery.EnvToken); discovery.EnvToken != "" && !isSet {
+		addError(fmt.Sprintf("environment variable %q is not set", discovery.EnvToken), "discover", "envtoken")
+	}
+	if !strings.Contains(origin.TargetDir, "{repo}") {
+		addError("has to contain {repo} for discovered origins", "targetdir")
+	}
+
+	return errs
+}
+
+// validateFrontmatter checks the precedence and the patterns of the rules of the front matter settings.
+// The fieldPath leads to the mapping of the settings
+func (config *Config) validateFrontmatter(settings *FrontmatterConfig, fieldPath ...interface{}) ConfigErrors {
+	var errs ConfigErrors
+	if settings == nil {
+		return errs
+	}
+
+	if settings.Precedence != "" && !isPrecedence(settings.Precedence) {
+		message := fmt.Sprintf("unknown precedence, use one of %s", strings.Join(precedences, ", "))
+		errs = append(errs, config.configError(message, append(append([]interface{}{}, fieldPath...), "precedence")...))
+	}
+	for j, rule := range settings.Rules {
+		if problem := checkPathPattern(rule.Match); problem != "" {
+			errs = append(errs, config.configError(problem, append(append([]interface{}{}, fieldPath...), "rules", j, "match")...))
+		}
+	}
+	return errs
+}
+
+// validateStaleness checks the thresholds of the staleness settings. maxStale is only allowed
+// if global is set. The fieldPath leads to the mapping of the settings
+func (config *Config) validateStaleness(settings *StalenessConfig, global bool, fieldPath ...interface{}) ConfigErrors {
+	var errs ConfigErrors
+	if settings == nil {
+		return errs
+	}
+
+	if settings.Days < 0 {
+		errs = append(errs, config.configError("days must not be negative", append(append([]interface{}{}, fieldPath...), "days")...))
+	}
+	if settings.MaxStale != nil {
+		if !global {
+			errs = append(errs, config.configError("maxStale is only supported globally", append(append([]interface{}{}, fieldPath...), "maxStale")...))
+		} else if *settings.MaxStale < 0 {
+			errs = append(errs, config.configError("maxStale must not be negative", append(append([]interface{}{}, fieldPath...), "maxStale")...))
+		}
+	}
+	return errs
+}
+
+// validateRepoSettings checks the allowed settings of the policy. The fieldPath leads to the mapping of the policy
+func (config *Config) validateRepoSettings(policy *RepoSettingsPolicy, fieldPath ...interface{}) ConfigErrors {
+	var errs ConfigErrors
+	if policy == nil {
+		return errs
+	}
+	for j, name := range policy.Allow {
+		if !isRepoSetting(name) {
+			message := fmt.Sprintf("unknown setting, use one of %s", strings.Join(repoSettingNames, ", "))
+			errs = append(errs, config.configError(message, append(append([]interface{}{}, fieldPath...), "allow", j)...))
+		}
+	}
+	return errs
+}
+
+// validateProcessors checks that the processors are registered and accept their options.
+// The fieldPath leads to the mapping containing the processors
+func (config *Config) validateProcessors(processorConfigs []ProcessorConfig, fieldPath ...interface{}) ConfigErrors {
+	var errs ConfigErrors
+
+	for j, processorConfig := range processorConfigs {
+		processorPath := append(append([]interface{}{}, fieldPath...), "processors", j)
+
+		processorsMutex.RLock()
+		_, isRegistered := processors[processorConfig.Name]
+		processorsMutex.RUnlock()
+		if !isRegistered {
+			message := fmt.Sprintf("unknown processor, use one of %s", strings.Join(registeredProcessorNames(), ", "))
+			errs = append(errs, config.configError(message, append(processorPath, "name")...))
+			continue
+		}
+
+		if _, err := newProcessor(processorConfig); err != nil {
+			errs = append(errs, config.configError(strings.TrimPrefix(err.Error(), "yaml: "), append(processorPath, "options")...))
+		} else if err := checkCommandAllowed(processorConfig, config.AllowedCommands); err != nil {
+			errs = append(errs, config.configError(err.Error(), append(processorPath, "options", "command")...))
+		}
+	}
+
+	return errs
+}
+
+// checkRelativePath returns a problem description if the path is absolute or
+// leaves its parent directory
+func checkRelativePath(p string) string {
+	if filepath.IsAbs(p) || path.IsAbs(filepath.ToSlash(p)) {
+		return "must be a relative path"
+	}
+	for _, element := range strings.Split(filepath.ToSlash(p), "/") {
+		if element == ".." {
+			return "must not contain '..'"
+		}
+	}
+	return ""
+}
+
+// cleanTargetDir returns the target dir as clean absolute slash path for comparison
+func cleanTargetDir(dir string) string {
+	return path.Clean("/" + filepath.ToSlash(dir))
+}
+
+// targetDirsOverlap returns true if both target dirs are the same or one of them is
+// a parent of the other
+func targetDirsOverlap(a string, b string) bool {
+	a = cleanTargetDir(a)
+	b = cleanTargetDir(b)
+	return a == b ||
+		strings.HasPrefix(a, strings.TrimSuffix(b, "/")+"/") ||
+		strings.HasPrefix(b, strings.TrimSuffix(a, "/")+"/")
+}
+
+func fieldPathString(fieldPath ...interface{}) string {
+	var field string
+	for _, element := range fieldPath {
+		switch key := element.(type) {
+		case string:
+			field = joinField(field, key)
+		case int:
+			field = fmt.Sprintf("%s[%d]", field, key)
+		}
+	}
+	return field
+}
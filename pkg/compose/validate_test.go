@@ -0,0 +1,234 @@
+package compose
+
+// run: go test ./pkg/compose -run TestValidate
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Flaque/filet"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestConfig(t *testing.T, content string) string {
+	return filet.TmpFile(t, GetLocalTempDir(t), content).Name()
+}
+
+func TestLoadConfigStrict(t *testing.T) {
+
+	t.Run("Unknown fields with line numbers", func(t *testing.T) {
+		configFile := writeTestConfig(t, `
+baseURL: "https://example.com/"
+white_list:
+  - ".md"
+origins:
+  - src: https://github.com/snipem/monako-test.git
+    branch: master
+    targetDir: docs/test
+`)
+		_, err := LoadConfig(configFile, "")
+		assert.Error(t, err)
+
+		errs, isConfigErrors := err.(ConfigErrors)
+		assert.True(t, isConfigErrors)
+		assert.Len(t, errs, 2)
+
+		assert.Equal(t, 3, errs[0].Line)
+		assert.Equal(t, "white_list", errs[0].Field)
+		assert.Contains(t, errs[0].Message, `did you mean "whitelist"?`)
+
+		assert.Equal(t, 8, errs[1].Line)
+		assert.Equal(t, "origins[0].targetDir", errs[1].Field)
+		assert.Contains(t, errs[1].Message, `did you mean "targetdir"?`)
+	})
+
+	t.Run("Duplicate fields", func(t *testing.T) {
+		configFile := writeTestConfig(t, `
+origins:
+  - src: https://github.com/snipem/monako-test.git
+    branch: master
+    branch: develop
+`)
+		_, err := LoadConfig(configFile, "")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), ":5: origins[0].branch: duplicate field, already defined in line 4")
+	})
+
+	t.Run("Wrong types", func(t *testing.T) {
+		configFile := writeTestConfig(t, `
+whitelist: ".md"
+origins:
+  - src: https://github.com/snipem/monako-test.git
+    branch: master
+`)
+		_, err := LoadConfig(configFile, "")
+		assert.Error(t, err)
+		errs := err.(ConfigErrors)
+		assert.Len(t, errs, 1)
+		assert.Equal(t, 2, errs[0].Line)
+	})
+
+	t.Run("Syntax error", func(t *testing.T) {
+		configFile := writeTestConfig(t, "origins: [")
+		_, err := LoadConfig(configFile, "")
+		assert.Error(t, err)
+	})
+}
+
+func TestValidate(t *testing.T) {
+
+	t.Run("Valid config", func(t *testing.T) {
+		config, _ := getTestConfig(t)
+		assert.Empty(t, config.Validate())
+	})
+
+	t.Run("No origins", func(t *testing.T) {
+		config := &Config{}
+		errs := config.Validate()
+		assert.Len(t, errs, 1)
+		assert.Equal(t, "origins", errs[0].Field)
+	})
+
+	t.Run("Semantic problems with line numbers", func(t *testing.T) {
+		configFile := writeTestConfig(t, `
+origins:
+  - src: https://github.com/snipem/monako-test.git
+    docdir: ../outside
+    targetdir: docs/test
+  - src: https://github.com/snipem/monako-test.git
+    branch: master
+    targetdir: /absolute
+  - src: https://github.com/snipem/monako-test.git
+    branch: master
+    targetdir: docs/test/
+    envusername: MONAKO_TEST_NOT_EXISTING_USER
+    envpassword: MONAKO_TEST_NOT_EXISTING_PASSWORD
+`)
+		_, err := LoadConfig(configFile, "")
+		assert.Error(t, err)
+		errs := err.(ConfigErrors)
+
+		var fields []string
+		var lines []int
+		for _, e := range errs {
+			fields = append(fields, e.Field)
+			lines = append(lines, e.Line)
+		}
+
+		assert.Equal(t, []string{
+			"origins[0].branch",
+			"origins[0].docdir",
+			"origins[1].targetdir",
+			"origins[2].envusername",
+			"origins[2].envpassword",
+			"origins[2].targetdir",
+		}, fields)
+		assert.Equal(t, []int{3, 4, 8, 12, 13, 11}, lines)
+	})
+
+	t.Run("Timeouts", func(t *testing.T) {
+		configFile := writeTestConfig(t, `
+timeout: 10m
+origins:
+  - src: https://github.com/snipem/monako-test.git
+    branch: master
+    targetdir: docs/test
+    timeout: 90s
+`)
+		config, err := LoadConfig(configFile, "")
+		assert.NoError(t, err)
+		assert.Equal(t, 10*time.Minute, config.Timeout)
+		assert.Equal(t, 90*time.Second, config.Origins[0].Timeout)
+
+		configFile = writeTestConfig(t, `
+origins:
+  - src: https://github.com/snipem/monako-test.git
+    branch: master
+    timeout: -1s
+`)
+		_, err = LoadConfig(configFile, "")
+		assert.Error(t, err)
+		errs := err.(ConfigErrors)
+		assert.Len(t, errs, 1)
+		assert.Equal(t, "origins[0].timeout", errs[0].Field)
+		assert.Equal(t, 5, errs[0].Line)
+	})
+
+	t.Run("Nested targetdirs", func(t *testing.T) {
+		configFile := writeTestConfig(t, `
+origins:
+  - src: https://github.com/snipem/monako-test.git
+    branch: master
+    targetdir: docs
+  - src: https://github.com/snipem/monako.git
+    branch: master
+    targetdir: docs/monako
+`)
+		config, err := LoadConfig(configFile, "")
+		assert.NoError(t, err)
+		warnings := config.Warnings()
+		assert.Len(t, warnings, 1)
+		assert.Equal(t, "origins[1].targetdir", warnings[0].Field)
+		assert.Equal(t, 8, warnings[0].Line)
+		assert.Contains(t, warnings[0].Message, `is nested with targetdir "docs" of origins[0]`)
+	})
+
+	t.Run("Auth env vars have to be set together", func(t *testing.T) {
+		origin := NewOrigin("https://github.com/snipem/monako-test.git", "master", ".", "docs")
+		origin.EnvUsername = "HOME"
+		config := &Config{Origins: []Origin{*origin}}
+		errs := config.Validate()
+		assert.Len(t, errs, 1)
+		assert.Equal(t, "origins[0]", errs[0].Field)
+	})
+}
+
+func TestTargetDirsOverlap(t *testing.T) {
+	assert.True(t, targetDirsOverlap("docs", "docs/"))
+	assert.True(t, targetDirsOverlap("docs", "docs/sub"))
+	assert.True(t, targetDirsOverlap("./docs/sub", "docs"))
+	assert.True(t, targetDirsOverlap("", "docs"))
+	assert.False(t, targetDirsOverlap("docs/a", "docs/b"))
+	assert.False(t, targetDirsOverlap("docs/a", "docs/ab"))
+}
+
+func TestCheckRelativePath(t *testing.T) {
+	assert.Empty(t, checkRelativePath("docs/test"))
+	assert.Empty(t, checkRelativePath("."))
+	assert.Empty(t, checkRelativePath("docs/..test"))
+	assert.NotEmpty(t, checkRelativePath("/docs"))
+	assert.NotEmpty(t, checkRelativePath("docs/../../"))
+}
+
+// TestConfigSchema checks that the published JSON Schema knows all config fields
+func TestConfigSchema(t *testing.T) {
+	schemaFile := filepath.Join("..", "..", "configs", "config.monako.schema.json")
+	data, err := ioutil.ReadFile(schemaFile)
+	assert.NoError(t, err)
+
+	var schema struct {
+		Properties  map[string]interface{} `json:"properties"`
+		Definitions map[string]struct {
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"definitions"`
+	}
+	assert.NoError(t, json.Unmarshal(data, &schema))
+
+	for field := range yamlFields(reflect.TypeOf(Config{})) {
+		assert.Contains(t, schema.Properties, field, "Config field missing in schema")
+	}
+	for field := range yamlFields(reflect.TypeOf(Origin{})) {
+		assert.Contains(t, schema.Definitions["origin"].Properties, field, "Origin field missing in schema")
+	}
+}
+
+func TestExampleConfigsAreValid(t *testing.T) {
+	for _, configFile := range []string{"../../configs/config.monako.yaml", "../../test/config.local.yaml"} {
+		_, err := LoadConfig(configFile, GetLocalTempDir(t))
+		assert.NoError(t, err, configFile)
+	}
+}